@@ -0,0 +1,126 @@
+package cpa
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fingerprint identifies a violation across decisions and policy changes that keep its rule, policy and reason.
+// The reason is normalized so that whitespace changes keep the fingerprint.
+func fingerprint(policyName string, violation Violation) string {
+	reason := strings.Join(strings.Fields(violation.Reason), " ")
+	sum := sha256.Sum256([]byte(policyName + "\x00" + violation.Rule + "\x00" + reason))
+	return hex.EncodeToString(sum[:8])
+}
+
+// fingerprint sets the fingerprint of violations from the policy defining their rule.
+func (policy Policy) fingerprint(violations []Violation) []Violation {
+	for i, violation := range violations {
+		violations[i].Fingerprint = fingerprint(policy.rules[violation.Rule].Policy, violation)
+	}
+	return violations
+}
+
+// Baseline lists known violations by fingerprint, e.g.:
+//
+//	{
+//	  "violations": [
+//	    {"fingerprint": "5c1f0a7e9d3b2c41", "rule": "context_allowlist", "reason": "prod context is reserved"}
+//	  ]
+//	}
+//
+// The rule and reason of each violation are informational: only fingerprints are matched.
+type Baseline struct {
+	Violations []BaselineViolation `json:"violations"`
+}
+
+type BaselineViolation struct {
+	Fingerprint string `json:"fingerprint"`
+	Rule        string `json:"rule,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// NewBaseline returns the baseline of the violations of decisions made with the Fingerprints option, sorted by
+// rule and reason. Violations without a fingerprint are left out.
+func NewBaseline(decisions ...*Decision) Baseline {
+	seen := make(map[string]struct{})
+	baseline := Baseline{Violations: []BaselineViolation{}}
+	for _, decision := range decisions {
+		for _, violations := range [][]Violation{decision.HardFailures, decision.SoftFailures, decision.Baselined} {
+			for _, violation := range violations {
+				if violation.Fingerprint == "" {
+					continue
+				}
+				if _, ok := seen[violation.Fingerprint]; ok {
+					continue
+				}
+				seen[violation.Fingerprint] = struct{}{}
+				baseline.Violations = append(baseline.Violations, BaselineViolation{
+					Fingerprint: violation.Fingerprint,
+					Rule:        violation.Rule,
+					Reason:      violation.Reason,
+				})
+			}
+		}
+	}
+	slices.SortFunc(baseline.Violations, func(a, b BaselineViolation) int {
+		return strings.Compare(a.Rule+a.Reason+a.Fingerprint, b.Rule+b.Reason+b.Fingerprint)
+	})
+	return baseline
+}
+
+// LoadBaseline reads a baseline file.
+func LoadBaseline(file string) (Baseline, error) {
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return Baseline{}, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return Baseline{}, fmt.Errorf("failed to parse baseline %q: %w", file, err)
+	}
+	return baseline, nil
+}
+
+// WriteBaseline writes a baseline file.
+func WriteBaseline(file string, baseline Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	if err := os.WriteFile(filepath.Clean(file), append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write baseline: %w", err)
+	}
+	return nil
+}
+
+func (baseline Baseline) contains(fingerprint string) bool {
+	return slices.ContainsFunc(baseline.Violations, func(violation BaselineViolation) bool {
+		return violation.Fingerprint == fingerprint
+	})
+}
+
+// applyBaseline moves the hard and soft failures of the baseline to the baselined violations of the decision.
+func (d *Decision) applyBaseline(baseline Baseline) {
+	split := func(violations []Violation) []Violation {
+		var remaining []Violation
+		for _, violation := range violations {
+			if baseline.contains(violation.Fingerprint) {
+				d.Baselined = append(d.Baselined, violation)
+				continue
+			}
+			remaining = append(remaining, violation)
+		}
+		return remaining
+	}
+	d.HardFailures = split(d.HardFailures)
+	d.SoftFailures = split(d.SoftFailures)
+	d.updateStatus()
+	d.sort()
+}
@@ -0,0 +1,81 @@
+package cpa
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+enable_rule["no_admin"]
+no_prod[reason] { job := input.jobs[_]; job.context == "prod"; reason := sprintf("job %s uses  prod", [job.name]) }
+no_admin = "admin context is deprecated" { input.jobs[_].context == "admin" }
+`})
+	require.NoError(t, err)
+
+	existing := map[string]any{"jobs": []any{
+		map[string]any{"name": "deploy", "context": "prod"},
+		map[string]any{"name": "release", "context": "admin"},
+	}}
+
+	decision, err := policy.Decide(context.Background(), existing, Fingerprints())
+	require.NoError(t, err)
+
+	deployFingerprint := fingerprint("contexts", Violation{Rule: "no_prod", Reason: "job deploy uses prod"})
+	adminFingerprint := fingerprint("contexts", Violation{Rule: "no_admin", Reason: "admin context is deprecated"})
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"no_admin", "no_prod"},
+		HardFailures: []Violation{{Rule: "no_prod", Reason: "job deploy uses  prod", Fingerprint: deployFingerprint}},
+		SoftFailures: []Violation{{Rule: "no_admin", Reason: "admin context is deprecated", Fingerprint: adminFingerprint}},
+	}, decision)
+
+	baseline := NewBaseline(decision)
+	require.Equal(t, Baseline{Violations: []BaselineViolation{
+		{Fingerprint: adminFingerprint, Rule: "no_admin", Reason: "admin context is deprecated"},
+		{Fingerprint: deployFingerprint, Rule: "no_prod", Reason: "job deploy uses  prod"},
+	}}, baseline)
+
+	file := filepath.Join(t.TempDir(), "baseline.json")
+	require.NoError(t, WriteBaseline(file, baseline))
+	loaded, err := LoadBaseline(file)
+	require.NoError(t, err)
+	require.Equal(t, baseline, loaded)
+
+	decision, err = policy.Decide(context.Background(), existing, WithBaseline(loaded))
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusPass,
+		EnabledRules: []string{"no_admin", "no_prod"},
+		Baselined: []Violation{
+			{Rule: "no_admin", Reason: "admin context is deprecated", Fingerprint: adminFingerprint},
+			{Rule: "no_prod", Reason: "job deploy uses  prod", Fingerprint: deployFingerprint},
+		},
+	}, decision)
+
+	introduced := map[string]any{"jobs": []any{
+		map[string]any{"name": "deploy", "context": "prod"},
+		map[string]any{"name": "publish", "context": "prod"},
+	}}
+
+	decision, err = policy.Decide(context.Background(), introduced, WithBaseline(loaded))
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"no_admin", "no_prod"},
+		HardFailures: []Violation{{
+			Rule:        "no_prod",
+			Reason:      "job publish uses  prod",
+			Fingerprint: fingerprint("contexts", Violation{Rule: "no_prod", Reason: "job publish uses prod"}),
+		}},
+		Baselined: []Violation{{Rule: "no_prod", Reason: "job deploy uses  prod", Fingerprint: deployFingerprint}},
+	}, decision)
+
+	_, err = LoadBaseline(filepath.Join(t.TempDir(), "missing.json"))
+	require.ErrorContains(t, err, "failed to read baseline")
+}
@@ -0,0 +1,99 @@
+package cpa
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/CircleCI-Public/circle-policy-agent/internal"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is the file name of the config located by DecideYAML unless the ConfigFile option is given.
+const DefaultConfigFile = ".circleci/config.yml"
+
+// DecideYAML parses a CircleCI config and decides on it as Decide does, applying the suppression comments of the
+// config. The path of each violation returned by a rule, when it has one, is resolved to the position of the
+// offending value in the config: the key of an object value or the item of an array. A path that cannot be fully
+// resolved points to its deepest value found.
+func (policy Policy) DecideYAML(ctx context.Context, config []byte, opts ...EvalOption) (*Decision, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(config, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	var input interface{}
+	if err := document.Decode(&input); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	input = internal.ConvertYAMLMapKeyTypes(input)
+
+	opts = append(slices.Clip(opts), Suppressions(suppressions(&document, config)))
+
+	decision, err := policy.Decide(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	file := newEvalOptions(opts).configFile
+	if file == "" {
+		file = DefaultConfigFile
+	}
+
+	for _, violations := range [][]Violation{decision.HardFailures, decision.SoftFailures, decision.Informational, decision.Baselined, decision.Suppressed} {
+		for i, violation := range violations {
+			if len(violation.Path) == 0 {
+				continue
+			}
+			if node := lookupNode(&document, violation.Path); node != nil {
+				violations[i].Source = &Location{File: file, Row: node.Line, Col: node.Column}
+			}
+		}
+	}
+
+	return decision, nil
+}
+
+// lookupNode returns the node of the document at path, or the node of its longest prefix found. Object values
+// are located at their key.
+func lookupNode(document *yaml.Node, path []string) *yaml.Node {
+	node := document
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	located := node
+	for _, segment := range path {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			key, value := mappingEntry(node, segment)
+			if value == nil {
+				return located
+			}
+			node, located = value, key
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node.Content) {
+				return located
+			}
+			node = node.Content[index]
+			located = node
+		default:
+			return located
+		}
+	}
+	return located
+}
+
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
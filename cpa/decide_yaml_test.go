@@ -0,0 +1,114 @@
+package cpa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDecideYAML(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+enable_rule["pinned_images"]
+enable_rule["no_orbs"]
+no_prod[{"reason": sprintf("%s: uses context prod", [name]), "path": ["workflows", wf, "jobs", i, name, "context"]}] {
+	job := input.workflows[wf].jobs[i][name]
+	job.context == "prod"
+}
+pinned_images[name] = {"reason": sprintf("%s: image is not pinned", [name]), "path": sprintf("jobs.%s.docker.0.image", [name])} {
+	endswith(input.jobs[name].docker[0].image, ":latest")
+}
+no_orbs = "orbs are not allowed" { input.orbs }
+`})
+	require.NoError(t, err)
+
+	config := []byte(`version: 2.1
+orbs:
+  node: circleci/node@5
+jobs:
+  build:
+    docker:
+      - image: cimg/base:latest
+workflows:
+  main:
+    jobs:
+      - build
+      - deploy:
+          context: prod
+`)
+
+	decision, err := policy.DecideYAML(context.Background(), config)
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"no_orbs", "no_prod", "pinned_images"},
+		HardFailures: []Violation{{
+			Rule:   "no_prod",
+			Reason: "deploy: uses context prod",
+			Path:   []string{"workflows", "main", "jobs", "1", "deploy", "context"},
+			Source: &Location{File: ".circleci/config.yml", Row: 13, Col: 11},
+		}},
+		SoftFailures: []Violation{
+			{Rule: "no_orbs", Reason: "orbs are not allowed"},
+			{
+				Rule:   "pinned_images",
+				Reason: "build: image is not pinned",
+				Path:   []string{"jobs", "build", "docker", "0", "image"},
+				Source: &Location{File: ".circleci/config.yml", Row: 7, Col: 9},
+			},
+		},
+	}, decision)
+
+	decision, err = policy.Decide(context.Background(), map[string]any{"jobs": map[string]any{
+		"build": map[string]any{"docker": []any{map[string]any{"image": "cimg/base:latest"}}},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []Violation{{
+		Rule:   "pinned_images",
+		Reason: "build: image is not pinned",
+		Path:   []string{"jobs", "build", "docker", "0", "image"},
+	}}, decision.SoftFailures)
+
+	t.Run("unresolved path points to deepest value", func(t *testing.T) {
+		decision, err := policy.DecideYAML(context.Background(), []byte(`workflows:
+  main:
+    jobs:
+      - deploy:
+          context: prod
+`), ConfigFile("ci.yml"))
+		require.NoError(t, err)
+		require.Equal(t, &Location{File: "ci.yml", Row: 5, Col: 11}, decision.HardFailures[0].Source)
+
+		require.Equal(t, 2, lookupNode(mustParseNode(t, "jobs:\n  build: {}\n"), []string{"jobs", "build", "steps"}).Line)
+	})
+
+	t.Run("complete rule returning an object", func(t *testing.T) {
+		policy, err := ParseBundle(map[string]string{"version.rego": `package org
+policy_name["version"]
+enable_rule["version"]
+version = {"reason": "config must use version 2.1", "path": ["version"]} { input.version != 2.1 }
+`})
+		require.NoError(t, err)
+
+		decision, err := policy.DecideYAML(context.Background(), []byte("version: 2\n"))
+		require.NoError(t, err)
+		require.Equal(t, []Violation{{
+			Rule:   "version",
+			Reason: "config must use version 2.1",
+			Path:   []string{"version"},
+			Source: &Location{File: ".circleci/config.yml", Row: 1, Col: 1},
+		}}, decision.SoftFailures)
+	})
+
+	_, err = policy.DecideYAML(context.Background(), []byte("jobs: [\n"))
+	require.ErrorContains(t, err, "failed to parse config")
+}
+
+func mustParseNode(t *testing.T, config string) *yaml.Node {
+	var node yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(config), &node))
+	return &node
+}
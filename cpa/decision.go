@@ -1,6 +1,10 @@
 package cpa
 
-import "sort"
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
 
 type Status string
 
@@ -11,18 +15,75 @@ const (
 	StatusError    Status = "ERROR"
 )
 
+// Layers of a decision made by an org policy with a project policy layered on top of it.
+const (
+	LayerOrg     = "org"
+	LayerProject = "project"
+)
+
+// Violation is a reason returned by an enabled rule. Title, Description, Severity and Links are copied
+// from the rule's METADATA annotation when it has one. Layer is only set when a project policy is layered on
+// the org policy, and names the layer of the rule. Fingerprint is only set by the Fingerprints and WithBaseline
+// options. Path is the path of the offending input value when the rule returns one, and Source its position in the
+// config when the decision is made by DecideYAML. SuppressionReason is the reason given by the comment suppressing
+// the violation, if any.
 type Violation struct {
-	Rule   string `json:"rule"`
-	Reason string `json:"reason"`
+	Rule              string    `json:"rule"`
+	Reason            string    `json:"reason"`
+	Fingerprint       string    `json:"fingerprint,omitempty"`
+	Path              []string  `json:"path,omitempty"`
+	Source            *Location `json:"source,omitempty"`
+	Layer             string    `json:"layer,omitempty"`
+	SuppressionReason string    `json:"suppression_reason,omitempty"`
+	Title             string    `json:"title,omitempty"`
+	Description       string    `json:"description,omitempty"`
+	Severity          string    `json:"severity,omitempty"`
+	Links             []Link    `json:"links,omitempty"`
+}
+
+// Location is a position within a policy or config file.
+type Location struct {
+	File string `json:"file"`
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+}
+
+// EvalError describes why a policy failed to evaluate. Code is the OPA error code, such as eval_conflict_error
+// or eval_builtin_error. PolicyName and Rule identify the policy and the rule that were being evaluated
+// when the error occurred, and are empty when the error is not located in a policy, e.g. in a circleci helper.
+type EvalError struct {
+	Code       string    `json:"code"`
+	Message    string    `json:"message"`
+	Location   *Location `json:"location,omitempty"`
+	PolicyName string    `json:"policy_name,omitempty"`
+	Rule       string    `json:"rule,omitempty"`
+}
+
+func (err EvalError) Error() string {
+	if err.Location == nil {
+		return fmt.Sprintf("%s: %s", err.Code, err.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s: %s", err.Location.File, err.Location.Row, err.Code, err.Message)
 }
 
 // Decision is a circleci flavoured output representing a policy decision.
+// When Status is StatusError, Error holds the structured evaluation error and Reason its message.
+// Informational holds the violations of rules being rolled out that do not apply to the project yet, and
+// Baselined the violations known by the baseline given with the WithBaseline option, or found in the base input
+// of DecideDelta, and Suppressed the violations suppressed by config comments: they never change the status.
+// UnmatchedSuppressions are the job and workflow suppressions that suppressed no violation, such as those of rules
+// whose violations have no path.
 type Decision struct {
-	Status       Status      `json:"status"`
-	Reason       string      `json:"reason,omitempty"`
-	EnabledRules []string    `json:"enabled_rules,omitempty"`
-	HardFailures []Violation `json:"hard_failures,omitempty"`
-	SoftFailures []Violation `json:"soft_failures,omitempty"`
+	Status                Status        `json:"status"`
+	Reason                string        `json:"reason,omitempty"`
+	Error                 *EvalError    `json:"error,omitempty"`
+	EnabledRules          []string      `json:"enabled_rules,omitempty"`
+	HardFailures          []Violation   `json:"hard_failures,omitempty"`
+	SoftFailures          []Violation   `json:"soft_failures,omitempty"`
+	Informational         []Violation   `json:"informational,omitempty"`
+	Baselined             []Violation   `json:"baselined,omitempty"`
+	Suppressed            []Violation   `json:"suppressed,omitempty"`
+	UnmatchedSuppressions []Suppression `json:"unmatched_suppressions,omitempty"`
 }
 
 // sort will sort the decision's enabled rules and hard/soft violations
@@ -31,10 +92,103 @@ type Decision struct {
 // Violations sorted by the combination of their rule and reason.
 func (d Decision) sort() {
 	sort.StringSlice(d.EnabledRules).Sort()
-	for _, violations := range [][]Violation{d.SoftFailures, d.HardFailures} {
-		sort.SliceStable(violations, func(i, j int) bool {
-			left, right := violations[i], violations[j]
-			return left.Rule+left.Reason < right.Rule+right.Reason
-		})
+	for _, violations := range [][]Violation{d.SoftFailures, d.HardFailures, d.Informational, d.Baselined, d.Suppressed} {
+		sortViolations(violations)
+	}
+}
+
+// sortViolations sorts violations by the combination of their rule and reason.
+func sortViolations(violations []Violation) {
+	sort.SliceStable(violations, func(i, j int) bool {
+		left, right := violations[i], violations[j]
+		return left.Rule+left.Reason < right.Rule+right.Reason
+	})
+}
+
+// updateStatus sets the status of a decision that did not fail to evaluate from its violations.
+func (d *Decision) updateStatus() {
+	switch {
+	case len(d.HardFailures) > 0:
+		d.Status = StatusHardFail
+	case len(d.SoftFailures) > 0:
+		d.Status = StatusSoftFail
+	default:
+		d.Status = StatusPass
+	}
+}
+
+// clone returns a copy of the decision that shares no list with it.
+func (d *Decision) clone() *Decision {
+	c := *d
+	if d.Error != nil {
+		err := *d.Error
+		c.Error = &err
+	}
+	c.EnabledRules = slices.Clone(d.EnabledRules)
+	c.HardFailures = slices.Clone(d.HardFailures)
+	c.SoftFailures = slices.Clone(d.SoftFailures)
+	c.Informational = slices.Clone(d.Informational)
+	c.Baselined = slices.Clone(d.Baselined)
+	c.Suppressed = slices.Clone(d.Suppressed)
+	c.UnmatchedSuppressions = slices.Clone(d.UnmatchedSuppressions)
+	return &c
+}
+
+// layerDecisions combines the decisions of an org policy and of the project policy layered on top of it,
+// tagging each violation with its layer. Soft failures of the org rules the project declares as hard failures are
+// hard failures. When the project policy fails to evaluate, the combined decision is an error decision that still
+// holds the violations of the org policy.
+func layerDecisions(org, project *Decision, projectHard map[string]struct{}) *Decision {
+	decision := &Decision{}
+
+	enabled := make(map[string]struct{})
+	for _, rules := range [][]string{org.EnabledRules, project.EnabledRules} {
+		for _, rule := range rules {
+			if _, ok := enabled[rule]; !ok {
+				enabled[rule] = struct{}{}
+				decision.EnabledRules = append(decision.EnabledRules, rule)
+			}
+		}
 	}
+
+	for _, layer := range []struct {
+		name     string
+		decision *Decision
+	}{{LayerOrg, org}, {LayerProject, project}} {
+		for _, violation := range layer.decision.HardFailures {
+			violation.Layer = layer.name
+			decision.HardFailures = append(decision.HardFailures, violation)
+		}
+		for _, violation := range layer.decision.SoftFailures {
+			violation.Layer = layer.name
+			if _, ok := projectHard[violation.Rule]; ok && layer.name == LayerOrg {
+				decision.HardFailures = append(decision.HardFailures, violation)
+				continue
+			}
+			decision.SoftFailures = append(decision.SoftFailures, violation)
+		}
+		for _, violation := range layer.decision.Informational {
+			violation.Layer = layer.name
+			decision.Informational = append(decision.Informational, violation)
+		}
+		for _, violation := range layer.decision.Suppressed {
+			violation.Layer = layer.name
+			decision.Suppressed = append(decision.Suppressed, violation)
+		}
+	}
+
+	// A suppression is unmatched when it suppressed no violation of either layer.
+	for _, suppression := range org.UnmatchedSuppressions {
+		if slices.ContainsFunc(project.UnmatchedSuppressions, suppression.equal) {
+			decision.UnmatchedSuppressions = append(decision.UnmatchedSuppressions, suppression)
+		}
+	}
+
+	decision.updateStatus()
+	if project.Status == StatusError {
+		decision.Status, decision.Reason, decision.Error = StatusError, project.Reason, project.Error
+	}
+	decision.sort()
+
+	return decision
 }
@@ -30,6 +30,7 @@ func TestJsonOutput(t *testing.T) {
 		d := Decision{
 			Status:       "",
 			Reason:       "cause",
+			Error:        &EvalError{},
 			EnabledRules: []string{""},
 			HardFailures: []Violation{{}},
 			SoftFailures: []Violation{{}},
@@ -53,7 +54,7 @@ func TestJsonOutput(t *testing.T) {
 
 		require.EqualValues(
 			t,
-			[]string{"enabled_rules", "hard_failures", "reason", "soft_failures", "status"},
+			[]string{"enabled_rules", "error", "hard_failures", "reason", "soft_failures", "status"},
 			keys,
 		)
 	})
@@ -0,0 +1,87 @@
+package cpa
+
+import (
+	"context"
+	"slices"
+)
+
+// DeltaDecision is the decision on a config change. Decision is the decision on the head config, failing only on
+// the Introduced violations: the Unchanged violations, also found in the base config, are moved to its baselined
+// violations. Resolved are the violations of the base config that the head config fixes.
+type DeltaDecision struct {
+	Decision   *Decision   `json:"decision"`
+	Introduced []Violation `json:"introduced,omitempty"`
+	Resolved   []Violation `json:"resolved,omitempty"`
+	Unchanged  []Violation `json:"unchanged,omitempty"`
+}
+
+// DecideDelta decides on the change from a base input, such as the config of a pull request's base branch, to a head
+// input. Both are decided with the evaluation options and violations are matched by fingerprint. The Shadow and
+// Suppressions options only apply to the head input. Violations baselined with the WithBaseline option or
+// suppressed are neither introduced nor unchanged. When the base input fails to evaluate, every violation of the
+// head input is introduced.
+func (policy Policy) DecideDelta(ctx context.Context, baseInput, headInput interface{}, opts ...EvalOption) (*DeltaDecision, error) {
+	// The base and head inputs are decided at the same time.
+	opts = append(fixClock(opts), Fingerprints())
+
+	// Suppression comments belong to the head config, and the shadow policy is compared on the head decision only.
+	baseOpts := append(slices.Clip(opts), Shadow(nil, nil), func(option *evalOptions) { option.suppressions = nil })
+
+	base, err := policy.Decide(ctx, baseInput, baseOpts...)
+	if err != nil {
+		return nil, err
+	}
+	head, err := policy.Decide(ctx, headInput, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &DeltaDecision{Decision: head}
+	if head.Status == StatusError {
+		return delta, nil
+	}
+
+	fingerprints := func(lists ...[]Violation) map[string]struct{} {
+		result := make(map[string]struct{})
+		for _, violations := range lists {
+			for _, violation := range violations {
+				result[violation.Fingerprint] = struct{}{}
+			}
+		}
+		return result
+	}
+	baseFingerprints := fingerprints(base.HardFailures, base.SoftFailures, base.Baselined)
+	headFingerprints := fingerprints(head.HardFailures, head.SoftFailures, head.Baselined, head.Suppressed)
+
+	split := func(violations []Violation) []Violation {
+		var introduced []Violation
+		for _, violation := range violations {
+			if _, ok := baseFingerprints[violation.Fingerprint]; ok {
+				delta.Unchanged = append(delta.Unchanged, violation)
+				head.Baselined = append(head.Baselined, violation)
+				continue
+			}
+			delta.Introduced = append(delta.Introduced, violation)
+			introduced = append(introduced, violation)
+		}
+		return introduced
+	}
+	head.HardFailures = split(head.HardFailures)
+	head.SoftFailures = split(head.SoftFailures)
+	head.updateStatus()
+	head.sort()
+
+	for _, violations := range [][]Violation{base.HardFailures, base.SoftFailures, base.Baselined} {
+		for _, violation := range violations {
+			if _, ok := headFingerprints[violation.Fingerprint]; !ok {
+				delta.Resolved = append(delta.Resolved, violation)
+			}
+		}
+	}
+
+	for _, violations := range [][]Violation{delta.Introduced, delta.Resolved, delta.Unchanged} {
+		sortViolations(violations)
+	}
+
+	return delta, nil
+}
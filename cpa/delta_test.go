@@ -0,0 +1,115 @@
+package cpa
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecideDelta(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+enable_rule["no_admin"]
+no_prod[reason] { job := input.jobs[_]; job.context == "prod"; reason := sprintf("job %s uses prod", [job.name]) }
+no_admin[reason] { job := input.jobs[_]; job.context == "admin"; reason := sprintf("job %s uses admin", [job.name]) }
+`})
+	require.NoError(t, err)
+
+	base := map[string]any{"jobs": []any{
+		map[string]any{"name": "deploy", "context": "prod"},
+		map[string]any{"name": "release", "context": "admin"},
+	}}
+	head := map[string]any{"jobs": []any{
+		map[string]any{"name": "deploy", "context": "prod"},
+		map[string]any{"name": "publish", "context": "prod"},
+	}}
+
+	violation := func(rule, reason string) Violation {
+		v := Violation{Rule: rule, Reason: reason}
+		v.Fingerprint = fingerprint("contexts", v)
+		return v
+	}
+	deploy := violation("no_prod", "job deploy uses prod")
+	publish := violation("no_prod", "job publish uses prod")
+	release := violation("no_admin", "job release uses admin")
+
+	delta, err := policy.DecideDelta(context.Background(), base, head)
+	require.NoError(t, err)
+	require.Equal(t, &DeltaDecision{
+		Decision: &Decision{
+			Status:       StatusHardFail,
+			EnabledRules: []string{"no_admin", "no_prod"},
+			HardFailures: []Violation{publish},
+			Baselined:    []Violation{deploy},
+		},
+		Introduced: []Violation{publish},
+		Resolved:   []Violation{release},
+		Unchanged:  []Violation{deploy},
+	}, delta)
+
+	delta, err = policy.DecideDelta(context.Background(), head, head)
+	require.NoError(t, err)
+	require.Equal(t, StatusPass, delta.Decision.Status)
+	require.Empty(t, delta.Introduced)
+	require.Empty(t, delta.Resolved)
+	require.Equal(t, []Violation{deploy, publish}, delta.Unchanged)
+
+	// Baselined violations are neither introduced nor unchanged, but are resolved once fixed.
+	baseline := NewBaseline(&Decision{HardFailures: []Violation{deploy}, SoftFailures: []Violation{release}})
+	delta, err = policy.DecideDelta(context.Background(), base, head, WithBaseline(baseline))
+	require.NoError(t, err)
+	require.Equal(t, &DeltaDecision{
+		Decision: &Decision{
+			Status:       StatusHardFail,
+			EnabledRules: []string{"no_admin", "no_prod"},
+			HardFailures: []Violation{publish},
+			Baselined:    []Violation{deploy},
+		},
+		Introduced: []Violation{publish},
+		Resolved:   []Violation{release},
+	}, delta)
+}
+
+func TestDecideDeltaHeadOptions(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+no_prod[{"reason": reason, "path": ["jobs", name, "context"]}] {
+	input.jobs[name].context == "prod"
+	reason := sprintf("job %s uses prod", [name])
+}
+`})
+	require.NoError(t, err)
+
+	base := map[string]any{"jobs": map[string]any{"deploy": map[string]any{"context": "prod"}}}
+	head := map[string]any{"jobs": map[string]any{
+		"deploy":  map[string]any{"context": "prod"},
+		"publish": map[string]any{"context": "prod"},
+	}}
+	suppressions := []Suppression{{Rules: []string{"no_prod"}, Scope: ScopeJob, Name: "deploy"}}
+
+	results := make(chan ShadowResult, 2)
+	delta, err := policy.DecideDelta(context.Background(), base, head,
+		Suppressions(suppressions),
+		Shadow(policy, func(result ShadowResult) { results <- result }),
+	)
+	require.NoError(t, err)
+
+	// The violation suppressed in the head config is neither introduced nor resolved.
+	require.Len(t, delta.Decision.Suppressed, 1)
+	require.Len(t, delta.Introduced, 1)
+	require.Empty(t, delta.Resolved)
+	require.Empty(t, delta.Unchanged)
+
+	// The shadow policy only decides on the head config.
+	result := <-results
+	require.Equal(t, delta.Decision.Suppressed, result.Shadow.Suppressed)
+	select {
+	case result := <-results:
+		t.Fatalf("unexpected shadow result for the base config: %v", result.Shadow)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,245 @@
+package cpa
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// Enablement is how a rule is enforced by a policy bundle.
+type Enablement string
+
+const (
+	EnablementDisabled Enablement = "disabled"
+	EnablementSoft     Enablement = "soft"
+	EnablementHard     Enablement = "hard"
+)
+
+// PolicyDiff describes what changed between two policy bundles, beyond their text.
+type PolicyDiff struct {
+	// Added, Removed and Modified are policy names. A policy is modified when its rules or imports change,
+	// not when only its formatting or comments do.
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	// Enablement lists the rules whose enablement changed.
+	Enablement []EnablementChange `json:"enablement,omitempty"`
+	// Imports lists the policies whose helper or library imports changed.
+	Imports []ImportChange `json:"imports,omitempty"`
+}
+
+// EnablementChange is a change of a rule's enablement, e.g. from soft to hard.
+type EnablementChange struct {
+	Rule string     `json:"rule"`
+	From Enablement `json:"from"`
+	To   Enablement `json:"to"`
+}
+
+// ImportChange lists the imports added to and removed from a policy.
+type ImportChange struct {
+	Policy  string   `json:"policy"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// DiffPolicies compares the old policy bundle with the head one. Enablement is computed from the constant
+// enable_rule, enable_hard and hard_fail declarations, regardless of their conditions.
+func DiffPolicies(old, head *Policy) (PolicyDiff, error) {
+	var diff PolicyDiff
+
+	oldModules, err := old.policyModules()
+	if err != nil {
+		return PolicyDiff{}, err
+	}
+	headModules, err := head.policyModules()
+	if err != nil {
+		return PolicyDiff{}, err
+	}
+
+	for _, name := range sortedKeys(headModules) {
+		oldModule, ok := oldModules[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case oldModule.Compare(headModules[name]) != 0:
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for _, name := range sortedKeys(oldModules) {
+		if _, ok := headModules[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	oldEnablement, headEnablement := enablement(old.packagePath(), oldModules), enablement(head.packagePath(), headModules)
+	for _, rule := range sortedKeys(mergeKeys(oldEnablement, headEnablement)) {
+		from, to := oldEnablement[rule], headEnablement[rule]
+		if from == "" {
+			from = EnablementDisabled
+		}
+		if to == "" {
+			to = EnablementDisabled
+		}
+		if from != to {
+			diff.Enablement = append(diff.Enablement, EnablementChange{Rule: rule, From: from, To: to})
+		}
+	}
+
+	for _, name := range sortedKeys(mergeKeys(oldModules, headModules)) {
+		change := ImportChange{Policy: name}
+		oldImports, headImports := dataImports(oldModules[name]), dataImports(headModules[name])
+		for _, path := range headImports {
+			if !slices.Contains(oldImports, path) {
+				change.Added = append(change.Added, path)
+			}
+		}
+		for _, path := range oldImports {
+			if !slices.Contains(headImports, path) {
+				change.Removed = append(change.Removed, path)
+			}
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			diff.Imports = append(diff.Imports, change)
+		}
+	}
+
+	return diff, nil
+}
+
+// Empty reports whether the bundles are equivalent.
+func (diff PolicyDiff) Empty() bool {
+	return len(diff.Added) == 0 &&
+		len(diff.Removed) == 0 &&
+		len(diff.Modified) == 0 &&
+		len(diff.Enablement) == 0 &&
+		len(diff.Imports) == 0
+}
+
+// String renders the diff as text, e.g.:
+//
+//	policies:
+//	  + branches
+//	  ~ contexts
+//	enablement:
+//	  context_allowlist: soft -> hard
+//	imports:
+//	  branches: + data.circleci.utils
+func (diff PolicyDiff) String() string {
+	if diff.Empty() {
+		return "no changes\n"
+	}
+
+	var sb strings.Builder
+
+	if len(diff.Added)+len(diff.Removed)+len(diff.Modified) > 0 {
+		sb.WriteString("policies:\n")
+		for _, group := range []struct {
+			sign  string
+			names []string
+		}{{"+", diff.Added}, {"-", diff.Removed}, {"~", diff.Modified}} {
+			for _, name := range group.names {
+				fmt.Fprintf(&sb, "  %s %s\n", group.sign, name)
+			}
+		}
+	}
+
+	if len(diff.Enablement) > 0 {
+		sb.WriteString("enablement:\n")
+		for _, change := range diff.Enablement {
+			fmt.Fprintf(&sb, "  %s: %s -> %s\n", change.Rule, change.From, change.To)
+		}
+	}
+
+	if len(diff.Imports) > 0 {
+		sb.WriteString("imports:\n")
+		for _, change := range diff.Imports {
+			var paths []string
+			for _, path := range change.Added {
+				paths = append(paths, "+ "+path)
+			}
+			for _, path := range change.Removed {
+				paths = append(paths, "- "+path)
+			}
+			fmt.Fprintf(&sb, "  %s: %s\n", change.Policy, strings.Join(paths, ", "))
+		}
+	}
+
+	return sb.String()
+}
+
+// policyModules parses the normalized source of the policies keyed by policy name, leaving out libraries and
+// helpers, with the options the policy was parsed with. Compiled modules are only used for their file name, since
+// the compiler drops imports and rewrites rule bodies.
+func (policy Policy) policyModules() (map[string]*ast.Module, error) {
+	modules := make(map[string]*ast.Module, len(policy.source))
+	for name, rego := range policy.source {
+		file := name
+		if compiled, ok := policy.compiler.Modules[name]; ok && compiled.Package.Location != nil {
+			file = compiled.Package.Location.File
+		}
+		mod, err := parseModule(file, rego, policy.options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse policy %q: %w", name, err)
+		}
+		modules[name] = mod
+	}
+	return modules, nil
+}
+
+// enablement returns the enablement of every rule enabled by the policy modules of the root package, keyed by rule
+// name.
+func enablement(root ast.Ref, modules map[string]*ast.Module) map[string]Enablement {
+	_, declarations := orgRules(root, modules)
+
+	declared := func(declaration string) map[string]struct{} {
+		names := make(map[string]struct{})
+		for _, term := range declarations[declaration] {
+			names[string(term.Value.(ast.String))] = struct{}{}
+		}
+		return names
+	}
+	enabled, hardFail, enabledHard := declared("enable_rule"), declared("hard_fail"), declared("enable_hard")
+
+	result := make(map[string]Enablement)
+	for rule := range enabled {
+		result[rule] = EnablementSoft
+		if _, ok := hardFail[rule]; ok {
+			result[rule] = EnablementHard
+		}
+	}
+	for rule := range enabledHard {
+		result[rule] = EnablementHard
+	}
+	return result
+}
+
+// dataImports returns the sorted data imports of a module, such as data.circleci.config. It returns nil for a nil module.
+func dataImports(mod *ast.Module) []string {
+	if mod == nil {
+		return nil
+	}
+	var imports []string
+	for _, imp := range mod.Imports {
+		ref, ok := imp.Path.Value.(ast.Ref)
+		if !ok || !ref.HasPrefix(ast.DefaultRootRef) {
+			continue
+		}
+		imports = append(imports, imp.String()[len("import "):])
+	}
+	slices.Sort(imports)
+	return imports
+}
+
+// mergeKeys returns a set of the keys of both maps.
+func mergeKeys[A, B any](a map[string]A, b map[string]B) map[string]struct{} {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for key := range a {
+		keys[key] = struct{}{}
+	}
+	for key := range b {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
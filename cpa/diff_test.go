@@ -0,0 +1,104 @@
+package cpa
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	old, err := ParseBundle(map[string]string{
+		"branches.rego": `package org
+policy_name["branches"]
+enable_rule["branch_prefix"]
+branch_prefix = "branch must be prefixed" { not startswith(data.meta.vcs.branch, "feature/") }
+`,
+		"contexts.rego": `package org
+import data.circleci.utils
+policy_name["contexts"]
+enable_rule["context_allowlist"]
+context_allowlist = "context not allowed" { utils.to_set(input.contexts)["prod"] }
+`,
+		"orbs.rego": `package org
+policy_name["orbs"]
+enable_hard["orb_versions"]
+orb_versions = "orbs must be pinned" { input.orbs[_] == "volatile" }
+`,
+	})
+	require.NoError(t, err)
+
+	head, err := ParseBundle(map[string]string{
+		"branches.rego": `package org
+
+# reformatted only
+policy_name["branches"]
+
+enable_rule["branch_prefix"]
+
+branch_prefix = "branch must be prefixed" { not startswith(data.meta.vcs.branch, "feature/") }
+`,
+		"contexts.rego": `package org
+import data.circleci.config
+policy_name["contexts"]
+enable_rule["context_allowlist"]
+hard_fail["context_allowlist"]
+context_allowlist = config.contexts_blocked_by_project_ids(data.meta.project_id, ["prod"])
+`,
+		"images.rego": `package org
+policy_name["images"]
+enable_rule["image_tags"]
+image_tags = "images must be tagged" { input.jobs[_].docker[_].image == "latest" }
+`,
+	})
+	require.NoError(t, err)
+
+	diff, err := DiffPolicies(old, head)
+	require.NoError(t, err)
+	require.Equal(t, PolicyDiff{
+		Added:    []string{"images"},
+		Removed:  []string{"orbs"},
+		Modified: []string{"contexts"},
+		Enablement: []EnablementChange{
+			{Rule: "context_allowlist", From: EnablementSoft, To: EnablementHard},
+			{Rule: "image_tags", From: EnablementDisabled, To: EnablementSoft},
+			{Rule: "orb_versions", From: EnablementHard, To: EnablementDisabled},
+		},
+		Imports: []ImportChange{
+			{Policy: "contexts", Added: []string{"data.circleci.config"}, Removed: []string{"data.circleci.utils"}},
+		},
+	}, diff)
+
+	require.Equal(t, `policies:
+  + images
+  - orbs
+  ~ contexts
+enablement:
+  context_allowlist: soft -> hard
+  image_tags: disabled -> soft
+  orb_versions: hard -> disabled
+imports:
+  contexts: + data.circleci.config, - data.circleci.utils
+`, diff.String())
+
+	data, err := json.Marshal(diff)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"added": ["images"],
+		"removed": ["orbs"],
+		"modified": ["contexts"],
+		"enablement": [
+			{"rule": "context_allowlist", "from": "soft", "to": "hard"},
+			{"rule": "image_tags", "from": "disabled", "to": "soft"},
+			{"rule": "orb_versions", "from": "hard", "to": "disabled"}
+		],
+		"imports": [
+			{"policy": "contexts", "added": ["data.circleci.config"], "removed": ["data.circleci.utils"]}
+		]
+	}`, string(data))
+
+	same, err := DiffPolicies(old, old)
+	require.NoError(t, err)
+	require.True(t, same.Empty())
+	require.Equal(t, "no changes\n", same.String())
+}
@@ -0,0 +1,37 @@
+package cpa
+
+import "github.com/CircleCI-Public/circle-policy-agent/internal/schemas"
+
+// Domain is an admission point policies make decisions for, such as CircleCI pipeline configuration, context
+// access requests, project settings changes or runner registration. Each domain has its own package root,
+// which decisions are read from, and its own input.
+type Domain struct {
+	// Name identifies the domain.
+	Name string
+	// Root is the package policies are declared in and Decide reads decisions from, such as org.
+	Root string
+	// ProjectRoot is the package of project policies layered on top of the policies of Root, such as project.
+	// The domain has no project layer when it is empty.
+	ProjectRoot string
+	// Libraries are the library packages allowed alongside policies, see LibraryPackages.
+	Libraries []string
+	// InputSchema is the JSON schema of the input document, decoded from JSON, used by the TypeCheck option.
+	// The input is not type checked when it is nil.
+	InputSchema any
+	// MetaSchema is the JSON schema of data.meta, decoded from JSON, used by the TypeCheck option.
+	// data.meta is not type checked when it is nil.
+	MetaSchema any
+}
+
+// ConfigDomain returns the default domain, in which policies of package org make decisions about CircleCI
+// pipeline configuration, with project policies of package project and libraries of package lib.*.
+func ConfigDomain() Domain {
+	return Domain{
+		Name:        "config",
+		Root:        LayerOrg,
+		ProjectRoot: LayerProject,
+		Libraries:   []string{"lib.*"},
+		InputSchema: schemas.Input(),
+		MetaSchema:  schemas.Meta(),
+	}
+}
@@ -0,0 +1,73 @@
+package cpa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomain(t *testing.T) {
+	runners := Domain{
+		Name: "runner_registration",
+		Root: "runner",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"resource_class": map[string]any{"type": "string"},
+			},
+			"additionalProperties": false,
+		},
+	}
+
+	bundle := map[string]string{"policy.rego": `package runner
+policy_name["resource_classes"]
+enable_hard["namespaced"]
+namespaced = "resource class must be namespaced" { not contains(input.resource_class, "/") }
+`}
+
+	policy, err := ParseBundle(bundle, WithDomain(runners), TypeCheck())
+	require.NoError(t, err)
+	require.Equal(t, "runner_registration", policy.Domain().Name)
+
+	decision, err := policy.Decide(context.Background(), map[string]any{"resource_class": "large"})
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"namespaced"},
+		HardFailures: []Violation{{Rule: "namespaced", Reason: "resource class must be namespaced"}},
+	}, decision)
+
+	_, err = ParseBundle(bundle)
+	require.ErrorContains(t, err, `expected one of packages [org, lib.*] but got "package runner"`)
+
+	_, err = ParseBundle(map[string]string{"policy.rego": `package runner
+policy_name["resource_classes"]
+enable_hard["namespaced"]
+namespaced = "resource class must be namespaced" { not contains(input.resourceclass, "/") }
+`}, WithDomain(runners), TypeCheck())
+	require.ErrorContains(t, err, "undefined ref: input.resourceclass")
+
+	_, err = ParseBundle(bundle, WithDomain(runners), ProjectLayer())
+	require.EqualError(t, err, `domain "runner_registration" has no project layer`)
+
+	_, err = ParseBundle(bundle, WithDomain(Domain{Name: "rootless"}))
+	require.EqualError(t, err, `domain "rootless" has no root package`)
+
+	_, err = ParseBundle(bundle, WithDomain(Domain{Name: "rootless", ProjectRoot: "project"}), ProjectLayer())
+	require.EqualError(t, err, `domain "rootless" has no root package`)
+
+	config, err := ParseBundle(map[string]string{"policy.rego": "package project\npolicy_name[\"project\"]\n"}, ProjectLayer())
+	require.NoError(t, err)
+	_, err = policy.Decide(context.Background(), map[string]any{}, Project(config))
+	require.EqualError(t, err, `project policy of domain "config" cannot be layered on domain "runner_registration"`)
+}
+
+func TestConfigDomainSchemasAreCopied(t *testing.T) {
+	domain := ConfigDomain()
+	domain.InputSchema.(map[string]any)["properties"] = nil
+	domain.MetaSchema.(map[string]any)["properties"] = nil
+
+	require.NotNil(t, ConfigDomain().InputSchema.(map[string]any)["properties"])
+	require.NotNil(t, ConfigDomain().MetaSchema.(map[string]any)["properties"])
+}
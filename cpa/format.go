@@ -0,0 +1,129 @@
+package cpa
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/format"
+)
+
+const formattingRuleID = "formatting"
+
+// Format formats every file of the bundle with the OPA formatter, as opa fmt does, using the bundle's rego
+// version. Files that fail to parse are returned unchanged: they are reported by ParseBundle and Lint.
+func Format(bundle map[string]string, opts ...ParseOption) map[string]string {
+	options := newParseOptions(opts)
+
+	result := make(map[string]string, len(bundle))
+	for file, rego := range bundle {
+		formatted, err := formatSource(file, rego, options)
+		if err != nil {
+			formatted = rego
+		}
+		result[file] = formatted
+	}
+	return result
+}
+
+// CheckFormat returns the unified diff between each file of the bundle that is not formatted and its formatted
+// source, keyed by file name. It returns an empty map when the whole bundle is formatted.
+func CheckFormat(bundle map[string]string, opts ...ParseOption) map[string]string {
+	diffs := make(map[string]string)
+	for file, formatted := range Format(bundle, opts...) {
+		if formatted != bundle[file] {
+			diffs[file] = unifiedDiff(file, bundle[file], formatted)
+		}
+	}
+	return diffs
+}
+
+// Formatting reports modules that are not formatted as opa fmt formats them, located at their first unformatted
+// statement. The package, imports, rules and comments of the module must have the position and text they have in
+// the formatted module. Its findings are fixable. The rule is disabled by DefaultLintConfig and can be enabled in
+// the lint configuration with the "formatting" rule.
+func Formatting() LintRule {
+	return LintRule{
+		ID:          formattingRuleID,
+		Description: "Policies must be formatted with opa fmt",
+		Severity:    SeverityWarning,
+		Check: func(m *ast.Module) []LintFinding {
+			if m.Package.Location == nil {
+				return nil
+			}
+			file := m.Package.Location.File
+			source, err := format.AstWithOpts(m.Copy(), format.Opts{RegoVersion: m.RegoVersion()})
+			if err != nil {
+				return nil
+			}
+			formatted, err := parseModule(file, string(source), parseOptions{version: m.RegoVersion()})
+			if err != nil {
+				return nil
+			}
+			loc := firstUnformatted(statements(m), statements(formatted))
+			if loc == nil {
+				return nil
+			}
+			return []LintFinding{{
+				Message: "file is not formatted, run opa fmt",
+				File:    file,
+				Row:     loc.Row,
+				Col:     1,
+			}}
+		},
+		// Fix formats every file it rewrites, so there is nothing else to do.
+		Fix: func(*ast.Module, LintFinding) bool {
+			return true
+		},
+	}
+}
+
+// statements returns the locations of the package, imports, rules and comments of a module sorted by position.
+func statements(m *ast.Module) []*ast.Location {
+	locations := []*ast.Location{m.Package.Location}
+	for _, imp := range m.Imports {
+		locations = append(locations, imp.Location)
+	}
+	for _, rule := range m.Rules {
+		locations = append(locations, rule.Location)
+	}
+	for _, comment := range m.Comments {
+		locations = append(locations, comment.Location)
+	}
+	slices.SortStableFunc(locations, func(a, b *ast.Location) int {
+		return cmp.Or(cmp.Compare(a.Row, b.Row), cmp.Compare(a.Col, b.Col))
+	})
+	return locations
+}
+
+// firstUnformatted returns the first location of a module's statements that differs from the location of the
+// formatted module's statement, or nil when they all match.
+func firstUnformatted(locations, formatted []*ast.Location) *ast.Location {
+	for i, loc := range locations {
+		if i >= len(formatted) {
+			return loc
+		}
+		other := formatted[i]
+		if loc.Row != other.Row || loc.Col != other.Col || !bytes.Equal(loc.Text, other.Text) {
+			return loc
+		}
+	}
+	if len(formatted) > len(locations) {
+		return formatted[len(locations)]
+	}
+	return nil
+}
+
+// formatSource formats a rego file with the rego version it is detected to use.
+func formatSource(file, rego string, options parseOptions) (string, error) {
+	mod, err := parseModule(file, rego, options)
+	if err != nil {
+		return "", err
+	}
+	formatted, err := format.AstWithOpts(mod, format.Opts{RegoVersion: mod.RegoVersion()})
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
@@ -0,0 +1,104 @@
+package cpa
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const unformattedPolicy = `package org
+policy_name["unformatted"]
+enable_rule["rule"]
+rule = "must run on main"   {
+	data.meta.vcs.branch != "main"
+}
+`
+
+const formattedPolicy = `package org
+
+policy_name["unformatted"]
+
+enable_rule["rule"]
+
+rule = "must run on main" {
+	data.meta.vcs.branch != "main"
+}
+`
+
+func TestFormat(t *testing.T) {
+	bundle := map[string]string{
+		"unformatted.rego": unformattedPolicy,
+		"formatted.rego":   formattedPolicy,
+		"invalid.rego":     "Invalid Content",
+	}
+
+	require.Equal(t, map[string]string{
+		"unformatted.rego": formattedPolicy,
+		"formatted.rego":   formattedPolicy,
+		"invalid.rego":     "Invalid Content",
+	}, Format(bundle))
+
+	diffs := CheckFormat(bundle)
+	require.Len(t, diffs, 1)
+	require.Equal(t, `--- unformatted.rego
++++ unformatted.rego
+@@ -1,6 +1,9 @@
+ package org
++
+ policy_name["unformatted"]
++
+ enable_rule["rule"]
+-rule = "must run on main"   {
++
++rule = "must run on main" {
+ 	data.meta.vcs.branch != "main"
+ }
+`, diffs["unformatted.rego"])
+
+	require.Empty(t, CheckFormat(map[string]string{"formatted.rego": formattedPolicy}))
+}
+
+func TestFormattingLintRule(t *testing.T) {
+	bundle := map[string]string{"unformatted.rego": unformattedPolicy}
+
+	require.Empty(t, Lint(bundle), "formatting rule must be disabled by default")
+
+	enabled := true
+	config := DefaultLintConfig()
+	config.Rules["formatting"] = LintRuleConfig{Enabled: &enabled}
+
+	require.Equal(t, LintReport{{
+		Rule:     "formatting",
+		Severity: SeverityWarning,
+		Message:  "file is not formatted, run opa fmt",
+		Policy:   "unformatted",
+		File:     "unformatted.rego",
+		Row:      2,
+		Col:      1,
+		Fixable:  true,
+	}}, Lint(bundle, WithLintConfig(config)))
+
+	result, err := Fix(bundle, WithLintConfig(config))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"unformatted.rego": formattedPolicy}, result.Files)
+}
+
+func TestFormattingChecksModule(t *testing.T) {
+	rule := Formatting()
+
+	mod, err := parseModule("formatted.rego", formattedPolicy, parseOptions{})
+	require.NoError(t, err)
+	require.Empty(t, rule.Check(mod))
+
+	// Statements are on the lines opa fmt puts them on, but the rule head is not formatted.
+	unformatted := strings.Replace(formattedPolicy, `"must run on main" {`, `"must run on main"   {`, 1)
+	mod, err = parseModule("unformatted.rego", unformatted, parseOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []LintFinding{{
+		Message: "file is not formatted, run opa fmt",
+		File:    "unformatted.rego",
+		Row:     7,
+		Col:     1,
+	}}, rule.Check(mod))
+}
@@ -13,7 +13,35 @@ var ErrNoPolicies = errors.New("no rego policies found")
 // LoadPolicyFromFS takes a filesystem path to load policy files from. It returns a parsed policy.
 // If the path is a file that policy is loaded as a bundle of 1 file. If the path is a directory that
 // directory is walked recursively searching for all rego files. If the bundle is empty an error is returned.
-func LoadPolicyFromFS(root string) (*Policy, error) {
+// Parse options are passed down to ParseBundle. The lint configuration file of the path's directory, if any,
+// configures the lint rules unless WithLintConfig is given. Parent directories are not searched.
+func LoadPolicyFromFS(root string, opts ...ParseOption) (*Policy, error) {
+	bundle, err := readBundle(root)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := root
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		dir = filepath.Dir(root)
+	}
+	configFile, err := findLintConfig(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find lint config: %w", err)
+	}
+	if configFile != "" {
+		config, err := LoadLintConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]ParseOption{WithLintConfig(config)}, opts...)
+	}
+
+	return ParseBundle(bundle, opts...)
+}
+
+// readBundle reads the rego files found at root keyed by path.
+func readBundle(root string) (map[string]string, error) {
 	var files []string
 
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
@@ -43,5 +71,5 @@ func LoadPolicyFromFS(root string) (*Policy, error) {
 		bundle[file] = string(data)
 	}
 
-	return ParseBundle(bundle)
+	return bundle, nil
 }
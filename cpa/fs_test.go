@@ -39,6 +39,16 @@ func TestLoadPolicyFromFS(t *testing.T) {
 			Path:        "./testdata/mixed_ext/policy.text",
 			ExpectedErr: "no rego policies found",
 		},
+		{
+			Name:             "applies lint config file",
+			Path:             "./testdata/lint_config",
+			ExpectedPolicies: []string{"legacy_branch"},
+		},
+		{
+			Name:        "ignores lint config file of parent directories",
+			Path:        "./testdata/lint_config/legacy",
+			ExpectedErr: "invalid use of data.meta.branch",
+		},
 		{
 			Name:             "only load rego files",
 			Path:             "./testdata/mixed_ext",
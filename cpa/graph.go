@@ -0,0 +1,274 @@
+package cpa
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// Kinds of the nodes of a policy graph.
+const (
+	GraphNodePolicy = "policy"
+	GraphNodeRule   = "rule"
+	GraphNodeHelper = "helper"
+)
+
+// Kinds of the edges of a policy graph: a policy defines rules, and rules use other rules and helpers.
+const (
+	GraphEdgeDefines = "defines"
+	GraphEdgeUses    = "uses"
+)
+
+// Graph is the dependency graph of the rules of a policy bundle. Its nodes are the policies, the rules of the policy
+// package, except for enablement declarations, and the helpers they use: the rules and functions of other packages,
+// such as data.circleci.config or library packages.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a node of a policy graph. Rule and helper IDs are their full path, e.g. data.org.context_allowlist,
+// and policy IDs their policy_name prefixed by "policy:". Enablement is set for the rules enabled by constant
+// enable_rule and enable_hard declarations, along with the helpers they depend on, directly or not. Unreachable
+// rules are neither enabled nor used by an enabled rule or an enablement declaration, so they never produce
+// violations. No rule is unreachable when a declaration enables rules by a computed name.
+type GraphNode struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Label       string     `json:"label"`
+	Enablement  Enablement `json:"enablement,omitempty"`
+	Helpers     []string   `json:"helpers,omitempty"`
+	Unreachable bool       `json:"unreachable,omitempty"`
+}
+
+// GraphEdge is an edge of a policy graph, from a policy to the rules it defines or from a rule to the rules and
+// helpers it uses.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// Graph builds the dependency graph of the policy from the rules each rule references, as compiled.
+func (policy Policy) Graph() Graph {
+	root := policy.packagePath()
+
+	nodes := make(map[string]*GraphNode)
+	edges := make(map[GraphEdge]struct{})
+	uses := make(map[string][]string)
+
+	walker := referenceWalker{compiler: policy.compiler}
+
+	var visit func(id string, rules []*ast.Rule)
+	visit = func(id string, rules []*ast.Rule) {
+		used := make(map[string][]*ast.Rule)
+		for _, rule := range rules {
+			for _, usedRule := range walker.usedRules(rule) {
+				used[graphRuleID(usedRule)] = append(used[graphRuleID(usedRule)], usedRule)
+			}
+		}
+		for _, usedID := range sortedKeys(used) {
+			if usedID == id {
+				continue
+			}
+			edge := GraphEdge{From: id, To: usedID, Kind: GraphEdgeUses}
+			if _, ok := edges[edge]; ok {
+				continue
+			}
+			edges[edge] = struct{}{}
+			uses[id] = append(uses[id], usedID)
+			if _, ok := nodes[usedID]; ok {
+				continue
+			}
+			nodes[usedID] = &GraphNode{ID: usedID, Kind: GraphNodeHelper, Label: usedID}
+			visit(usedID, used[usedID])
+		}
+	}
+
+	modules := make(map[string]*ast.Module)
+	ruleDefinitions := make(map[string][]*ast.Rule)
+	// Enablement declarations are not nodes of the graph, but the rules they use are reachable. Rules enabled by a
+	// computed name are unknown, in which case no rule is marked unreachable.
+	var declarations []*ast.Rule
+	computed := false
+	for _, name := range sortedKeys(policy.source) {
+		mod, ok := policy.compiler.Modules[name]
+		if !ok {
+			continue
+		}
+		modules[name] = mod
+		policyID := "policy:" + name
+		nodes[policyID] = &GraphNode{ID: policyID, Kind: GraphNodePolicy, Label: name}
+		if !mod.Package.Path.Equal(root) {
+			continue
+		}
+		for _, rule := range mod.Rules {
+			name := ruleName(mod, rule.Head.Ref().GroundPrefix())
+			if _, ok := enablementRules[name]; ok {
+				declarations = append(declarations, rule)
+				if (name == "enable_rule" || name == "enable_hard") && enabledRuleTerm(rule.Head) == nil {
+					computed = true
+				}
+				continue
+			}
+			if name == "" {
+				continue
+			}
+			id := graphRuleID(rule)
+			if _, ok := nodes[id]; !ok {
+				nodes[id] = &GraphNode{ID: id, Kind: GraphNodeRule, Label: name}
+			}
+			edges[GraphEdge{From: policyID, To: id, Kind: GraphEdgeDefines}] = struct{}{}
+			ruleDefinitions[id] = append(ruleDefinitions[id], rule)
+		}
+	}
+	for _, id := range sortedKeys(ruleDefinitions) {
+		visit(id, ruleDefinitions[id])
+	}
+
+	reachable := make(map[string]struct{})
+	var reach func(id string)
+	reach = func(id string) {
+		if _, ok := reachable[id]; ok {
+			return
+		}
+		reachable[id] = struct{}{}
+		for _, used := range uses[id] {
+			reach(used)
+		}
+	}
+
+	// helpers returns the helpers a rule depends on, directly or not.
+	helpers := func(id string) []string {
+		var result []string
+		visited := make(map[string]struct{})
+		var walk func(id string)
+		walk = func(id string) {
+			for _, used := range uses[id] {
+				if _, ok := visited[used]; ok {
+					continue
+				}
+				visited[used] = struct{}{}
+				if nodes[used].Kind == GraphNodeHelper {
+					result = append(result, used)
+				}
+				walk(used)
+			}
+		}
+		walk(id)
+		slices.Sort(result)
+		return result
+	}
+
+	// Rules used by enabled rules or by enablement declarations are reachable, and enabled rules depend on the
+	// helpers they reach.
+	for rule, enablement := range enablement(root, modules) {
+		id := root.Append(ast.StringTerm(rule)).String()
+		node, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		node.Enablement = enablement
+		node.Helpers = helpers(id)
+		reach(id)
+	}
+	for _, declaration := range declarations {
+		for _, used := range walker.usedRules(declaration) {
+			reach(graphRuleID(used))
+		}
+	}
+
+	var graph Graph
+	for _, id := range sortedKeys(nodes) {
+		node := nodes[id]
+		if _, ok := reachable[id]; !ok && node.Kind == GraphNodeRule && !computed {
+			node.Unreachable = true
+		}
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	for edge := range edges {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	slices.SortFunc(graph.Edges, func(a, b GraphEdge) int {
+		return strings.Compare(a.From+"\x00"+a.To, b.From+"\x00"+b.To)
+	})
+	return graph
+}
+
+// graphRuleID returns the full path of a rule, e.g. data.org.context_allowlist.
+func graphRuleID(rule *ast.Rule) string {
+	if rule.Module == nil {
+		return rule.Head.Ref().GroundPrefix().String()
+	}
+	return rule.Module.Package.Path.Append(ast.StringTerm(ruleName(rule.Module, rule.Head.Ref().GroundPrefix()))).String()
+}
+
+// DOT renders the graph in the Graphviz DOT language. Enabled rules are filled, in red when they are hard failures,
+// unreachable rules are dashed and the edges used by enabled rules are bold.
+func (graph Graph) DOT() string {
+	var sb strings.Builder
+
+	sb.WriteString("digraph policy {\n")
+	sb.WriteString("  rankdir=LR;\n")
+
+	used := make(map[string]struct{})
+	for _, node := range graph.Nodes {
+		if node.Enablement == "" {
+			continue
+		}
+		used[node.ID] = struct{}{}
+	}
+	// Edges from the nodes reachable from enabled rules are bold: mark those nodes until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, edge := range graph.Edges {
+			if _, ok := used[edge.From]; !ok || edge.Kind != GraphEdgeUses {
+				continue
+			}
+			if _, ok := used[edge.To]; !ok {
+				used[edge.To] = struct{}{}
+				changed = true
+			}
+		}
+	}
+
+	for _, node := range graph.Nodes {
+		attributes := []string{fmt.Sprintf("label=%q", node.Label)}
+		switch node.Kind {
+		case GraphNodePolicy:
+			attributes = append(attributes, "shape=folder")
+		case GraphNodeHelper:
+			attributes = append(attributes, "shape=ellipse")
+		default:
+			attributes = append(attributes, "shape=box")
+		}
+		switch {
+		case node.Enablement == EnablementHard:
+			attributes = append(attributes, "style=filled", `fillcolor="#f4a6a6"`)
+		case node.Enablement == EnablementSoft:
+			attributes = append(attributes, "style=filled", `fillcolor="#fbe6a2"`)
+		case node.Unreachable:
+			attributes = append(attributes, "style=dashed", "color=gray", "fontcolor=gray")
+		}
+		fmt.Fprintf(&sb, "  %q [%s];\n", node.ID, strings.Join(attributes, ", "))
+	}
+
+	for _, edge := range graph.Edges {
+		var attributes []string
+		if edge.Kind == GraphEdgeDefines {
+			attributes = append(attributes, "style=dotted")
+		} else if _, ok := used[edge.From]; ok {
+			attributes = append(attributes, "penwidth=2")
+		}
+		if len(attributes) == 0 {
+			fmt.Fprintf(&sb, "  %q -> %q;\n", edge.From, edge.To)
+			continue
+		}
+		fmt.Fprintf(&sb, "  %q -> %q [%s];\n", edge.From, edge.To, strings.Join(attributes, ", "))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -0,0 +1,104 @@
+package cpa
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraph(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"policy.rego": `package org
+import future.keywords
+import data.circleci.config
+policy_name["graph"]
+enable_rule["blocked_contexts"]
+enable_rule["orbs_blocked"]
+enable_hard["no_orbs"]
+blocked_contexts = config.contexts_blocked_by_project_ids(["project"], ["prod"])
+orbs_blocked = "orbs are blocked" { has_orbs; blocked_contexts }
+no_orbs = "orbs are not allowed" { has_orbs }
+has_orbs { count(input.orbs) > 0 }
+unused = "never enabled" { has_orbs }
+`})
+	require.NoError(t, err)
+
+	graph := policy.Graph()
+
+	nodes := make(map[string]GraphNode)
+	for _, node := range graph.Nodes {
+		nodes[node.ID] = node
+	}
+	require.Equal(t, GraphNode{
+		ID:         "data.org.blocked_contexts",
+		Kind:       GraphNodeRule,
+		Label:      "blocked_contexts",
+		Enablement: EnablementSoft,
+		Helpers:    []string{"data.circleci.config.contexts_blocked_by_project_ids", "data.circleci.utils.to_set"},
+	}, nodes["data.org.blocked_contexts"])
+	require.Equal(t, nodes["data.org.blocked_contexts"].Helpers, nodes["data.org.orbs_blocked"].Helpers)
+	require.Equal(t, EnablementHard, nodes["data.org.no_orbs"].Enablement)
+	require.Empty(t, nodes["data.org.no_orbs"].Helpers)
+	require.False(t, nodes["data.org.has_orbs"].Unreachable)
+	require.True(t, nodes["data.org.unused"].Unreachable)
+	require.Equal(t, GraphNodeHelper, nodes["data.circleci.utils.to_set"].Kind)
+	require.Equal(t, GraphNode{ID: "policy:graph", Kind: GraphNodePolicy, Label: "graph"}, nodes["policy:graph"])
+
+	require.Contains(t, graph.Edges, GraphEdge{From: "policy:graph", To: "data.org.unused", Kind: GraphEdgeDefines})
+	require.Contains(t, graph.Edges, GraphEdge{From: "data.org.unused", To: "data.org.has_orbs", Kind: GraphEdgeUses})
+	require.Contains(t, graph.Edges, GraphEdge{
+		From: "data.circleci.config.contexts_blocked_by_project_ids",
+		To:   "data.circleci.utils.to_set",
+		Kind: GraphEdgeUses,
+	})
+	for _, edge := range graph.Edges {
+		require.NotEqual(t, "data.org.enable_rule", edge.To)
+	}
+
+	dot := graph.DOT()
+	require.Contains(t, dot, `"data.org.no_orbs" [label="no_orbs", shape=box, style=filled, fillcolor="#f4a6a6"];`)
+	require.Contains(t, dot, `"data.org.unused" [label="unused", shape=box, style=dashed, color=gray, fontcolor=gray];`)
+	require.Contains(t, dot, `"data.org.no_orbs" -> "data.org.has_orbs" [penwidth=2];`)
+	require.Contains(t, dot, `"data.org.unused" -> "data.org.has_orbs";`)
+
+	data, err := json.Marshal(graph)
+	require.NoError(t, err)
+	var decoded Graph
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, graph, decoded)
+}
+
+func TestGraphReachability(t *testing.T) {
+	unreachable := func(policy *Policy) []string {
+		var result []string
+		for _, node := range policy.Graph().Nodes {
+			if node.Unreachable {
+				result = append(result, node.Label)
+			}
+		}
+		return result
+	}
+
+	// Rules used by the bodies of enablement declarations are reachable.
+	policy, err := ParseBundle(map[string]string{"policy.rego": `package org
+policy_name["graph"]
+enable_rule["no_orbs"] { enforced }
+hard_fail["no_orbs"] { strict }
+no_orbs = "orbs are not allowed" { count(input.orbs) > 0 }
+enforced { input.enforce }
+strict { data.meta.project_id == "strict" }
+unused = "never enabled" { input.unused }
+`})
+	require.NoError(t, err)
+	require.Equal(t, []string{"unused"}, unreachable(policy))
+
+	// Rules enabled by a computed name are unknown, so no rule is marked unreachable.
+	policy, err = ParseBundle(map[string]string{"policy.rego": `package org
+policy_name["graph"]
+enable_rule[name] { name := concat("_", ["no", "orbs"]) }
+no_orbs = "orbs are not allowed" { count(input.orbs) > 0 }
+unused = "never enabled" { input.unused }
+`})
+	require.NoError(t, err)
+	require.Empty(t, unreachable(policy))
+}
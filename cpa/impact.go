@@ -0,0 +1,327 @@
+package cpa
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/CircleCI-Public/circle-policy-agent/internal"
+	"gopkg.in/yaml.v3"
+)
+
+// ImpactRecord is a recorded evaluation replayed by AnalyzeImpact.
+type ImpactRecord struct {
+	File  string `json:"file"`
+	Input any    `json:"input"`
+	Meta  any    `json:"meta,omitempty"`
+}
+
+// LoadImpactCorpus reads the records of an impact analysis from the JSON and YAML files found in dir and its
+// subdirectories. A file holding an object with an input key is a record, as written to decision logs:
+//
+//	{"input": {"version": 2.1, ...}, "meta": {"project_id": "...", "vcs": {"branch": "main"}}}
+//
+// Any other file is a saved config used as the input, without meta.
+func LoadImpactCorpus(dir string) ([]ImpactRecord, error) {
+	var records []ImpactRecord
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".json", ".yml", ".yaml":
+		default:
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+
+		var document any
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("failed to parse record %q: %w", path, err)
+		}
+		document = internal.ConvertYAMLMapKeyTypes(document)
+
+		record := ImpactRecord{File: path, Input: document}
+		if object, ok := document.(map[string]any); ok {
+			if input, ok := object["input"]; ok {
+				record.Input = input
+				record.Meta = object["meta"]
+			}
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load impact corpus: %w", err)
+	}
+
+	return records, nil
+}
+
+// ImpactOptions configures AnalyzeImpact. Parallelism is the number of records evaluated concurrently and
+// defaults to GOMAXPROCS. EvalOptions are passed to every decision, after the record's meta.
+type ImpactOptions struct {
+	Parallelism int
+	EvalOptions []EvalOption
+}
+
+// ImpactReport summarizes how the decisions of a candidate policy differ from the current policy's over a corpus.
+type ImpactReport struct {
+	Total   int `json:"total"`
+	Changed int `json:"changed"`
+	// Transitions counts the records whose decision status changed, by change of status.
+	Transitions []Transition `json:"transitions,omitempty"`
+	// Rules counts the records whose outcome changed for a rule, by rule and change of outcome. The outcome of a
+	// rule is PASS when it has no violation, SOFT_FAIL or HARD_FAIL otherwise.
+	Rules []RuleImpact `json:"rules,omitempty"`
+	// Projects counts the records whose decision status changed, by project and change of status.
+	Projects []ProjectImpact `json:"projects,omitempty"`
+	// Changes details every record whose decision changed.
+	Changes []DecisionChange `json:"changes,omitempty"`
+}
+
+// Transition is a change of status shared by Count records.
+type Transition struct {
+	From  Status `json:"from"`
+	To    Status `json:"to"`
+	Count int    `json:"count"`
+}
+
+type RuleImpact struct {
+	Rule        string       `json:"rule"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// ProjectImpact groups transitions by the project_id of the records' meta, which is empty for records without one.
+type ProjectImpact struct {
+	ProjectID   string       `json:"project_id"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// DecisionChange is a record whose decision differs between the current and candidate policies.
+// Rules lists the rules whose outcome changed, if any: a decision can also change by its violations' reasons.
+type DecisionChange struct {
+	File      string       `json:"file"`
+	ProjectID string       `json:"project_id,omitempty"`
+	From      *Decision    `json:"from"`
+	To        *Decision    `json:"to"`
+	Rules     []RuleChange `json:"rules,omitempty"`
+}
+
+type RuleChange struct {
+	Rule string `json:"rule"`
+	From Status `json:"from"`
+	To   Status `json:"to"`
+}
+
+// AnalyzeImpact replays every record against the current and candidate policies and reports the decisions that
+// changed. Records are evaluated concurrently. An error is returned when a decision cannot be made, e.g. when the
+// context is canceled; policies failing to evaluate make decisions with StatusError instead.
+func AnalyzeImpact(ctx context.Context, current, candidate *Policy, records []ImpactRecord, options ImpactOptions) (*ImpactReport, error) {
+	parallelism := options.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+
+	changes := make([]*DecisionChange, len(records))
+	errs := make([]error, len(records))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(parallelism, len(records)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				changes[i], errs[i] = replay(ctx, current, candidate, records[i], options.EvalOptions)
+			}
+		}()
+	}
+	for i := range records {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	report := &ImpactReport{Total: len(records)}
+	transitions := make(map[[2]Status]int)
+	ruleTransitions := make(map[string]map[[2]Status]int)
+	projectTransitions := make(map[string]map[[2]Status]int)
+
+	count := func(groups map[string]map[[2]Status]int, key string, from, to Status) {
+		if groups[key] == nil {
+			groups[key] = make(map[[2]Status]int)
+		}
+		groups[key][[2]Status{from, to}]++
+	}
+
+	for i, change := range changes {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("failed to replay record %q: %w", records[i].File, errs[i])
+		}
+		if change == nil {
+			continue
+		}
+		report.Changed++
+		report.Changes = append(report.Changes, *change)
+		for _, rule := range change.Rules {
+			count(ruleTransitions, rule.Rule, rule.From, rule.To)
+		}
+		if change.From.Status != change.To.Status {
+			transitions[[2]Status{change.From.Status, change.To.Status}]++
+			count(projectTransitions, change.ProjectID, change.From.Status, change.To.Status)
+		}
+	}
+
+	report.Transitions = sortedTransitions(transitions)
+	for _, rule := range sortedKeys(ruleTransitions) {
+		report.Rules = append(report.Rules, RuleImpact{Rule: rule, Transitions: sortedTransitions(ruleTransitions[rule])})
+	}
+	for _, project := range sortedKeys(projectTransitions) {
+		report.Projects = append(report.Projects, ProjectImpact{
+			ProjectID:   project,
+			Transitions: sortedTransitions(projectTransitions[project]),
+		})
+	}
+
+	return report, nil
+}
+
+// replay returns how the decision on a record changes, or nil when it does not.
+func replay(ctx context.Context, current, candidate *Policy, record ImpactRecord, opts []EvalOption) (*DecisionChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opts = append([]EvalOption{Meta(record.Meta)}, opts...)
+
+	from, err := current.Decide(ctx, record.Input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	to, err := candidate.Decide(ctx, record.Input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if decisionsEqual(from, to) {
+		return nil, nil
+	}
+
+	change := &DecisionChange{File: record.File, From: from, To: to}
+	if meta, ok := record.Meta.(map[string]any); ok {
+		change.ProjectID, _ = meta["project_id"].(string)
+	}
+
+	fromOutcomes, toOutcomes := ruleOutcomes(from), ruleOutcomes(to)
+	for _, rule := range sortedKeys(mergeKeys(fromOutcomes, toOutcomes)) {
+		fromOutcome, toOutcome := fromOutcomes[rule], toOutcomes[rule]
+		if fromOutcome == "" {
+			fromOutcome = StatusPass
+		}
+		if toOutcome == "" {
+			toOutcome = StatusPass
+		}
+		if fromOutcome != toOutcome {
+			change.Rules = append(change.Rules, RuleChange{Rule: rule, From: fromOutcome, To: toOutcome})
+		}
+	}
+
+	return change, nil
+}
+
+// ruleOutcomes returns the outcome of every rule violated by the decision.
+func ruleOutcomes(decision *Decision) map[string]Status {
+	outcomes := make(map[string]Status)
+	for _, violation := range decision.SoftFailures {
+		outcomes[violation.Rule] = StatusSoftFail
+	}
+	for _, violation := range decision.HardFailures {
+		outcomes[violation.Rule] = StatusHardFail
+	}
+	return outcomes
+}
+
+func decisionsEqual(a, b *Decision) bool {
+	violationsEqual := func(a, b []Violation) bool {
+		return slices.EqualFunc(a, b, func(a, b Violation) bool {
+			return a.Rule == b.Rule && a.Reason == b.Reason
+		})
+	}
+	return a.Status == b.Status &&
+		a.Reason == b.Reason &&
+		violationsEqual(a.HardFailures, b.HardFailures) &&
+		violationsEqual(a.SoftFailures, b.SoftFailures)
+}
+
+func sortedTransitions(counts map[[2]Status]int) []Transition {
+	var transitions []Transition
+	for key, count := range counts {
+		transitions = append(transitions, Transition{From: key[0], To: key[1], Count: count})
+	}
+	slices.SortFunc(transitions, func(a, b Transition) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(string(a.From)+string(a.To), string(b.From)+string(b.To))
+	})
+	return transitions
+}
+
+// String renders the summary of the report as text, e.g.:
+//
+//	2 of 10 decisions changed
+//	  PASS -> HARD_FAIL: 2
+//	rules:
+//	  context_allowlist: PASS -> HARD_FAIL: 2
+//	projects:
+//	  6f3b...: PASS -> HARD_FAIL: 2
+func (report ImpactReport) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%d of %d decisions changed\n", report.Changed, report.Total)
+	for _, transition := range report.Transitions {
+		fmt.Fprintf(&sb, "  %s\n", transition)
+	}
+
+	if len(report.Rules) > 0 {
+		sb.WriteString("rules:\n")
+		for _, rule := range report.Rules {
+			for _, transition := range rule.Transitions {
+				fmt.Fprintf(&sb, "  %s: %s\n", rule.Rule, transition)
+			}
+		}
+	}
+
+	if len(report.Projects) > 0 {
+		sb.WriteString("projects:\n")
+		for _, project := range report.Projects {
+			id := project.ProjectID
+			if id == "" {
+				id = "(no project)"
+			}
+			for _, transition := range project.Transitions {
+				fmt.Fprintf(&sb, "  %s: %s\n", id, transition)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func (transition Transition) String() string {
+	return fmt.Sprintf("%s -> %s: %d", transition.From, transition.To, transition.Count)
+}
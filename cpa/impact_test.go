@@ -0,0 +1,104 @@
+package cpa
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeImpact(t *testing.T) {
+	records, err := LoadImpactCorpus("./testdata/impact")
+	require.NoError(t, err)
+	require.Equal(t, []ImpactRecord{
+		{
+			File:  "testdata/impact/config.yml",
+			Input: map[string]any{"version": 2.1, "jobs": map[string]any{"deploy": map[string]any{"context": "prod"}}},
+		},
+		{
+			File:  "testdata/impact/logs/prod.json",
+			Input: map[string]any{"jobs": map[string]any{"deploy": map[string]any{"context": "prod"}}},
+			Meta:  map[string]any{"project_id": "project-a", "vcs": map[string]any{"branch": "main"}},
+		},
+		{
+			File:  "testdata/impact/logs/staging.json",
+			Input: map[string]any{"jobs": map[string]any{"deploy": map[string]any{"context": "staging"}}},
+			Meta:  map[string]any{"project_id": "project-b", "vcs": map[string]any{"branch": "main"}},
+		},
+	}, records)
+
+	current, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+no_prod = "prod context is reserved" { input.jobs[_].context == "prod"; not data.meta.project_id == "project-a" }
+`})
+	require.NoError(t, err)
+
+	candidate, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+no_prod = "prod context is reserved" { input.jobs[_].context == "prod" }
+`})
+	require.NoError(t, err)
+
+	report, err := AnalyzeImpact(context.Background(), current, candidate, records, ImpactOptions{Parallelism: 2})
+	require.NoError(t, err)
+
+	violation := Violation{Rule: "no_prod", Reason: "prod context is reserved"}
+	require.Equal(t, &ImpactReport{
+		Total:   3,
+		Changed: 2,
+		Transitions: []Transition{
+			{From: StatusPass, To: StatusHardFail, Count: 1},
+			{From: StatusSoftFail, To: StatusHardFail, Count: 1},
+		},
+		Rules: []RuleImpact{{Rule: "no_prod", Transitions: []Transition{
+			{From: StatusPass, To: StatusHardFail, Count: 1},
+			{From: StatusSoftFail, To: StatusHardFail, Count: 1},
+		}}},
+		Projects: []ProjectImpact{
+			{ProjectID: "", Transitions: []Transition{{From: StatusSoftFail, To: StatusHardFail, Count: 1}}},
+			{ProjectID: "project-a", Transitions: []Transition{{From: StatusPass, To: StatusHardFail, Count: 1}}},
+		},
+		Changes: []DecisionChange{
+			{
+				File:  "testdata/impact/config.yml",
+				From:  &Decision{Status: StatusSoftFail, EnabledRules: []string{"no_prod"}, SoftFailures: []Violation{violation}},
+				To:    &Decision{Status: StatusHardFail, EnabledRules: []string{"no_prod"}, HardFailures: []Violation{violation}},
+				Rules: []RuleChange{{Rule: "no_prod", From: StatusSoftFail, To: StatusHardFail}},
+			},
+			{
+				File:      "testdata/impact/logs/prod.json",
+				ProjectID: "project-a",
+				From:      &Decision{Status: StatusPass, EnabledRules: []string{"no_prod"}},
+				To:        &Decision{Status: StatusHardFail, EnabledRules: []string{"no_prod"}, HardFailures: []Violation{violation}},
+				Rules:     []RuleChange{{Rule: "no_prod", From: StatusPass, To: StatusHardFail}},
+			},
+		},
+	}, report)
+
+	require.Equal(t, `2 of 3 decisions changed
+  PASS -> HARD_FAIL: 1
+  SOFT_FAIL -> HARD_FAIL: 1
+rules:
+  no_prod: PASS -> HARD_FAIL: 1
+  no_prod: SOFT_FAIL -> HARD_FAIL: 1
+projects:
+  (no project): SOFT_FAIL -> HARD_FAIL: 1
+  project-a: PASS -> HARD_FAIL: 1
+`, report.String())
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"changes":[{"file":"testdata/impact/config.yml","from":{"status":"SOFT_FAIL"`)
+
+	report, err = AnalyzeImpact(context.Background(), current, current, records, ImpactOptions{})
+	require.NoError(t, err)
+	require.Equal(t, &ImpactReport{Total: 3}, report)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = AnalyzeImpact(ctx, current, candidate, records, ImpactOptions{})
+	require.ErrorIs(t, err, context.Canceled)
+}
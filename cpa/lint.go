@@ -1,46 +1,342 @@
 package cpa
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/open-policy-agent/opa/ast"
 )
 
-type LintRule func(*ast.Module) error
+type Severity string
 
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// LintRule checks a single policy module. ID identifies the rule in lint reports, and Severity is the severity
+// given to every finding of the rule. Only findings of SeverityError prevent a bundle from being compiled.
+// Fix is optional: when set it rewrites the module in place to resolve one of the rule's findings and reports
+// whether it did, which makes the rule's findings fixable by Fix.
+type LintRule struct {
+	ID          string
+	Description string
+	Severity    Severity
+	Check       func(*ast.Module) []LintFinding
+	Fix         func(*ast.Module, LintFinding) bool
+}
+
+// BundleLintRule checks all modules of a bundle together. It catches problems that span several policy files
+// which a LintRule, seeing a single module, cannot. Bundle lint rules run after module lint rules and compilation.
+type BundleLintRule struct {
+	ID          string
+	Description string
+	Severity    Severity
+	Check       func(LintBundle) []LintFinding
+}
+
+// LintBundle is the bundle checked by a BundleLintRule.
+type LintBundle struct {
+	// Root is the package policies are declared in, such as data.org, or data.project for a project layer.
+	Root ast.Ref
+	// Project is set when the bundle is a project layer, parsed with the ProjectLayer option.
+	Project bool
+	// Modules are the policy modules keyed by policy name, along with the library modules keyed by their file name
+	// prefixed with "library:".
+	Modules map[string]*ast.Module
+	// Compiler is the compiler the bundle was compiled with. It is nil when the bundle failed to compile, in which
+	// case the compilation errors are already reported.
+	Compiler *ast.Compiler
+}
+
+// LintFinding is a single problem reported by a lint rule.
+type LintFinding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Policy   string   `json:"policy,omitempty"`
+	File     string   `json:"file"`
+	Row      int      `json:"row"`
+	Col      int      `json:"col"`
+	Fixable  bool     `json:"fixable,omitempty"`
+}
+
+func (finding LintFinding) String() string {
+	if finding.File == "" {
+		return finding.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", finding.File, finding.Row, finding.Message)
+}
+
+// LintReport is the list of findings produced by linting a bundle, sorted by location.
+type LintReport []LintFinding
+
+// HasErrors reports whether any finding has SeverityError.
+func (report LintReport) HasErrors() bool {
+	return slices.ContainsFunc(report, func(finding LintFinding) bool {
+		return finding.Severity == SeverityError
+	})
+}
+
+// Err returns the findings of SeverityError as a MultiError of LintError, or nil if there are none.
+func (report LintReport) Err() error {
+	var multiErr MultiError
+	for _, finding := range report {
+		if finding.Severity != SeverityError {
+			continue
+		}
+		err := LintError(finding.String())
+		if finding.Policy != "" {
+			multiErr = append(multiErr, fmt.Errorf("%q: %w", finding.Policy, err))
+		} else {
+			multiErr = append(multiErr, err)
+		}
+	}
+	if len(multiErr) == 0 {
+		return nil
+	}
+	return multiErr
+}
+
+func (report LintReport) sort() {
+	slices.SortStableFunc(report, func(a, b LintFinding) int {
+		return cmp.Or(
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Row, b.Row),
+			cmp.Compare(a.Col, b.Col),
+			cmp.Compare(a.Rule, b.Rule),
+		)
+	})
+}
+
+// Lint parses the bundle and runs the lint rules and bundle lint rules used by ParseBundle against it, as
+// selected by the lint configuration. Unlike ParseBundle it does not stop at the first failing stage: files
+// that fail to parse are reported as findings of the "parse" rule and every other file is still linted.
+func Lint(bundle map[string]string, opts ...ParseOption) LintReport {
+	opts = append([]ParseOption{WithLintConfig(DefaultLintConfig())}, opts...)
+	options := newParseOptions(opts)
+	rules, bundleRules := options.lintConfig.rules(options)
+	return lintBundle(bundle, rules, bundleRules, opts...)
+}
+
+func defaultLintRules(options parseOptions) []LintRule {
+	return []LintRule{AllowedPackages(append([]string{options.packageName()}, options.libraryPackages()...)...), DisallowMetaBranch()}
+}
+
+func defaultBundleLintRules() []BundleLintRule {
+	return []BundleLintRule{
+		EnabledRulesDefined(),
+		UnusedRules(),
+		DuplicateRules(),
+		ConflictingHardFail(),
+		HelperImports(),
+	}
+}
+
+func lintBundle(bundle map[string]string, rules []LintRule, bundleRules []BundleLintRule, opts ...ParseOption) LintReport {
+	options := newParseOptions(opts)
+
+	var report LintReport
+
+	modules := make(map[string]*ast.Module, len(bundle))
+	for file, rego := range bundle {
+		mod, err := parseModule(file, rego, options)
+		if err != nil {
+			report = append(report, parseFindings(file, err)...)
+			continue
+		}
+		if options.isLibrary(mod) {
+			modules[libraryKey(file)] = mod
+			continue
+		}
+		name, err := parsePolicyName(mod)
+		if err != nil {
+			report = append(report, LintFinding{
+				Rule:     policyName,
+				Severity: SeverityError,
+				Message:  err.Error(),
+				File:     file,
+				Row:      mod.Package.Location.Row,
+				Col:      mod.Package.Location.Col,
+			})
+			continue
+		}
+		modules[name] = mod
+	}
+
+	report = append(report, lintModules(modules, rules)...)
+
+	compiler := compileModules(maps.Clone(modules), options)
+	if compiler.Failed() {
+		report = append(report, compileFindings(compiler.Errors)...)
+		compiler = nil
+	}
+
+	report = append(report, lintModuleMap(LintBundle{Root: options.packagePath(), Project: options.project, Modules: modules, Compiler: compiler}, bundleRules)...)
+	report = options.lintConfig.apply(report, modules)
+	report.sort()
+
+	return report
+}
+
+func compileFindings(errs ast.Errors) []LintFinding {
+	findings := make([]LintFinding, 0, len(errs))
+	for _, e := range errs {
+		finding := findingAt(e.Location, "%s", e.Message)
+		finding.Rule, finding.Severity = "compile", SeverityError
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func parseFindings(file string, err error) []LintFinding {
+	errs, ok := err.(ast.Errors)
+	if !ok {
+		return []LintFinding{{Rule: "parse", Severity: SeverityError, Message: err.Error(), File: file}}
+	}
+	findings := make([]LintFinding, 0, len(errs))
+	for _, e := range errs {
+		finding := LintFinding{Rule: "parse", Severity: SeverityError, Message: e.Message, File: file}
+		if e.Location != nil {
+			finding.Row, finding.Col = e.Location.Row, e.Location.Col
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// lintModules runs the rules against every policy module keyed by policy name.
+func lintModules(modules map[string]*ast.Module, rules []LintRule) LintReport {
+	var report LintReport
+	for policy, mod := range modules {
+		for _, rule := range rules {
+			for _, finding := range rule.Check(mod) {
+				finding.Rule = rule.ID
+				finding.Severity = rule.Severity
+				finding.Fixable = rule.Fix != nil
+				if finding.File == "" && mod.Package.Location != nil {
+					finding.File = mod.Package.Location.File
+				}
+				// Library modules, and modules without a valid policy name, are keyed by file name.
+				if policy != finding.File && !isLibraryKey(policy) {
+					finding.Policy = policy
+				}
+				report = append(report, finding)
+			}
+		}
+	}
+	report.sort()
+	return report
+}
+
+// lintModuleMap runs the bundle rules against the bundle.
+func lintModuleMap(bundle LintBundle, rules []BundleLintRule) LintReport {
+	files := make(map[string]string, len(bundle.Modules))
+	for policy, mod := range bundle.Modules {
+		if mod.Package.Location != nil && mod.Package.Location.File != policy && !isLibraryKey(policy) {
+			files[mod.Package.Location.File] = policy
+		}
+	}
+
+	var report LintReport
+	for _, rule := range rules {
+		for _, finding := range rule.Check(bundle) {
+			finding.Rule = rule.ID
+			finding.Severity = rule.Severity
+			if finding.Policy == "" {
+				finding.Policy = files[finding.File]
+			}
+			report = append(report, finding)
+		}
+	}
+	report.sort()
+	return report
+}
+
+// matchPackage reports whether the module's package is one of the given packages.
+func matchPackage(m *ast.Module, packages []string) bool {
+	packageName := strings.TrimPrefix(m.Package.String(), "package ")
+	for _, name := range packages {
+		if root, ok := strings.CutSuffix(name, ".*"); ok {
+			if strings.HasPrefix(packageName, root+".") || strings.HasPrefix(packageName, root+"[") {
+				return true
+			}
+			continue
+		}
+		if name == packageName {
+			return true
+		}
+	}
+	return false
+}
+
+// findingAt returns a finding with the given message located at loc.
+func findingAt(loc *ast.Location, format string, args ...any) LintFinding {
+	finding := LintFinding{Message: fmt.Sprintf(format, args...)}
+	if loc != nil {
+		finding.File, finding.Row, finding.Col = loc.File, loc.Row, loc.Col
+	}
+	return finding
+}
+
+// AllowedPackages reports modules declared outside of the given packages. A package ending with ".*" allows
+// every package below it, such as lib.* for package lib.strings.
 func AllowedPackages(names ...string) LintRule {
-	return func(m *ast.Module) error {
-		packageName := strings.TrimPrefix(m.Package.String(), "package ")
-		for _, name := range names {
-			if name == packageName {
+	return LintRule{
+		ID:          "allowed-packages",
+		Description: "Policies must be declared in one of the allowed packages",
+		Severity:    SeverityError,
+		Check: func(m *ast.Module) []LintFinding {
+			if matchPackage(m, names) {
 				return nil
 			}
-		}
-		return lintErrf(
-			"invalid package name: expected one of packages [%s] but got %q",
-			strings.Join(names, ", "),
-			m.Package,
-		)
+			return []LintFinding{findingAt(
+				m.Package.Location,
+				"invalid package name: expected one of packages [%s] but got %q",
+				strings.Join(names, ", "),
+				m.Package,
+			)}
+		},
 	}
 }
 
 func DisallowMetaBranch() LintRule {
-	return func(m *ast.Module) error {
-		for _, rule := range m.Rules {
-			for _, expr := range []*ast.Expr(rule.Body) {
-				terms, ok := expr.Terms.([]*ast.Term)
-				if !ok {
-					continue
-				}
-				for _, term := range terms {
-					if term != nil && term.String() == "data.meta.branch" {
-						return lintErrf("%s: invalid use of data.meta.branch use data.meta.vcs.branch instead", term.Location.String())
+	return LintRule{
+		ID:          "disallow-meta-branch",
+		Description: "data.meta.branch is not provided, data.meta.vcs.branch must be used instead",
+		Severity:    SeverityError,
+		Check: func(m *ast.Module) []LintFinding {
+			var findings []LintFinding
+			for _, rule := range m.Rules {
+				for _, expr := range []*ast.Expr(rule.Body) {
+					terms, ok := expr.Terms.([]*ast.Term)
+					if !ok {
+						continue
+					}
+					for _, term := range terms {
+						if term != nil && term.String() == "data.meta.branch" {
+							findings = append(findings, findingAt(
+								term.Location,
+								"invalid use of data.meta.branch use data.meta.vcs.branch instead",
+							))
+						}
 					}
 				}
 			}
-		}
-		return nil
+			return findings
+		},
+		Fix: func(m *ast.Module, finding LintFinding) bool {
+			term := termAt(m, finding, "data.meta.branch")
+			if term == nil {
+				return false
+			}
+			term.Value = ast.MustParseRef("data.meta.vcs.branch")
+			return true
+		},
 	}
 }
 
@@ -56,7 +352,3 @@ func (LintError) Is(target error) bool {
 	_, ok := target.(LintError)
 	return ok
 }
-
-func lintErrf(format string, args ...any) LintError {
-	return LintError(fmt.Sprintf(format, args...))
-}
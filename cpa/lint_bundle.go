@@ -0,0 +1,309 @@
+package cpa
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// orgRules returns the rules declared by modules of the root package, such as data.org, keyed by rule name,
+// along with the constant rule names referenced by each enablement declaration. Rule names are mapped to their
+// first declaration.
+func orgRules(root ast.Ref, modules map[string]*ast.Module) (rules map[string]*ast.Rule, enabled map[string][]*ast.Term) {
+	rules = make(map[string]*ast.Rule)
+	enabled = make(map[string][]*ast.Term)
+
+	for _, policy := range sortedKeys(modules) {
+		mod := modules[policy]
+		if !mod.Package.Path.Equal(root) {
+			continue
+		}
+		for _, rule := range mod.Rules {
+			name := ruleName(mod, rule.Head.Ref().GroundPrefix())
+			if _, ok := enablementRules[name]; ok {
+				if term := enabledRuleTerm(rule.Head); term != nil {
+					enabled[name] = append(enabled[name], term)
+				}
+				continue
+			}
+			if len(rule.Head.Args) > 0 || name == "" {
+				continue
+			}
+			if _, ok := rules[name]; !ok {
+				rules[name] = rule
+			}
+		}
+	}
+
+	return rules, enabled
+}
+
+// enabledRuleTerm returns the constant rule name declared by an enablement rule head such as enable_rule["name"]
+// or enable_rule contains "name". It returns nil when the name is computed.
+func enabledRuleTerm(head *ast.Head) *ast.Term {
+	if head.Key != nil {
+		if _, ok := head.Key.Value.(ast.String); ok {
+			return head.Key
+		}
+		return nil
+	}
+	if ref := head.Ref(); len(ref) > 1 {
+		if _, ok := ref[1].Value.(ast.String); ok {
+			return ref[1]
+		}
+	}
+	return nil
+}
+
+// packagePath returns the path of a package such as org or admission.context, e.g. data.org.
+func packagePath(name string) ast.Ref {
+	path := ast.DefaultRootRef.Copy()
+	for _, segment := range strings.Split(name, ".") {
+		path = append(path, ast.StringTerm(segment))
+	}
+	return path
+}
+
+// EnabledRulesDefined reports rule names declared in enable_rule, hard_fail, enable_hard or non_suppressible that no
+// policy of package org defines. Such rules never produce violations, so a typo silently disables the rule or lets
+// its violations be suppressed. Project layers are not checked since they may enable rules of the org policy they
+// are layered on.
+func EnabledRulesDefined() BundleLintRule {
+	return BundleLintRule{
+		ID:          "undefined-enabled-rule",
+		Description: "Rules referenced by enable_rule, hard_fail, enable_hard and non_suppressible must be defined",
+		Severity:    SeverityError,
+		Check: func(bundle LintBundle) []LintFinding {
+			if bundle.Project {
+				return nil
+			}
+			rules, enabled := orgRules(bundle.Root, bundle.Modules)
+			pkg := strings.TrimPrefix(bundle.Root.String(), "data.")
+
+			var findings []LintFinding
+			for _, declaration := range []string{"enable_rule", "hard_fail", "enable_hard", "non_suppressible"} {
+				for _, term := range enabled[declaration] {
+					name := string(term.Value.(ast.String))
+					if _, ok := rules[name]; ok {
+						continue
+					}
+					findings = append(findings, findingAt(
+						term.Location,
+						"%s references rule %q which is not defined in package %s",
+						declaration,
+						name,
+						pkg,
+					))
+				}
+			}
+			return findings
+		},
+	}
+}
+
+// UnusedRules reports rules of package org that are never enabled and never referenced by another rule.
+// Such rules are usually violations that were meant to be enabled.
+func UnusedRules() BundleLintRule {
+	return BundleLintRule{
+		ID:          "unused-rule",
+		Description: "Rules should be enabled with enable_rule or enable_hard, or used by another rule",
+		Severity:    SeverityWarning,
+		Check: func(bundle LintBundle) []LintFinding {
+			rules, enabled := orgRules(bundle.Root, bundle.Modules)
+			root := bundle.Root
+
+			used := make(map[string]struct{})
+			for _, declaration := range []string{"enable_rule", "enable_hard"} {
+				for _, term := range enabled[declaration] {
+					used[string(term.Value.(ast.String))] = struct{}{}
+				}
+			}
+
+			for _, mod := range bundle.Modules {
+				for _, rule := range mod.Rules {
+					name := ruleName(mod, rule.Head.Ref().GroundPrefix())
+					ast.WalkVars(rule.Body, func(v ast.Var) bool {
+						if string(v) != name {
+							used[string(v)] = struct{}{}
+						}
+						return false
+					})
+					ast.WalkRefs(rule, func(ref ast.Ref) bool {
+						if ref.HasPrefix(root) && len(ref) > len(root) {
+							if s, ok := ref[len(root)].Value.(ast.String); ok && string(s) != name {
+								used[string(s)] = struct{}{}
+							}
+						}
+						return false
+					})
+				}
+			}
+
+			var findings []LintFinding
+			for _, name := range sortedKeys(rules) {
+				if _, ok := used[name]; ok {
+					continue
+				}
+				findings = append(findings, findingAt(rules[name].Location, "rule %q is defined but never enabled", name))
+			}
+			return findings
+		},
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// DuplicateRules reports rules of package org defined by more than one policy. Rules of a package are merged
+// across files, so two policies defining the same rule either conflict during evaluation or silently combine
+// their violations.
+func DuplicateRules() BundleLintRule {
+	return BundleLintRule{
+		ID:          "duplicate-rule",
+		Description: "Rules should be defined by a single policy",
+		Severity:    SeverityWarning,
+		Check: func(bundle LintBundle) []LintFinding {
+			definedBy := make(map[string]string)
+
+			var findings []LintFinding
+			for _, policy := range sortedKeys(bundle.Modules) {
+				mod := bundle.Modules[policy]
+				if !mod.Package.Path.Equal(bundle.Root) {
+					continue
+				}
+				seen := make(map[string]struct{})
+				for _, rule := range mod.Rules {
+					name := ruleName(mod, rule.Head.Ref().GroundPrefix())
+					if _, ok := enablementRules[name]; ok || name == "" {
+						continue
+					}
+					if _, ok := seen[name]; ok {
+						continue
+					}
+					seen[name] = struct{}{}
+
+					other, ok := definedBy[name]
+					if !ok {
+						definedBy[name] = policy
+						continue
+					}
+					findings = append(findings, findingAt(
+						rule.Location,
+						"rule %q is also defined by policy %q",
+						name,
+						other,
+					))
+				}
+			}
+			return findings
+		},
+	}
+}
+
+// ConflictingHardFail reports hard_fail and enable_hard declarations made by a policy for a rule that another
+// policy defines. The owning policy's own enablement is then silently overridden.
+func ConflictingHardFail() BundleLintRule {
+	return BundleLintRule{
+		ID:          "conflicting-hard-fail",
+		Description: "Only the policy defining a rule should declare it as a hard failure",
+		Severity:    SeverityWarning,
+		Check: func(bundle LintBundle) []LintFinding {
+			rules, _ := orgRules(bundle.Root, bundle.Modules)
+
+			owners := make(map[*ast.Rule]string)
+			for policy, mod := range bundle.Modules {
+				for _, rule := range mod.Rules {
+					owners[rule] = policy
+				}
+			}
+
+			var findings []LintFinding
+			for _, policy := range sortedKeys(bundle.Modules) {
+				mod := bundle.Modules[policy]
+				if !mod.Package.Path.Equal(bundle.Root) {
+					continue
+				}
+				for _, rule := range mod.Rules {
+					declaration := ruleName(mod, rule.Head.Ref().GroundPrefix())
+					if declaration != "hard_fail" && declaration != "enable_hard" {
+						continue
+					}
+					term := enabledRuleTerm(rule.Head)
+					if term == nil {
+						continue
+					}
+					name := string(term.Value.(ast.String))
+					defined, ok := rules[name]
+					if !ok || owners[defined] == policy {
+						continue
+					}
+					findings = append(findings, findingAt(
+						term.Location,
+						"%s declares rule %q as a hard failure but it is defined by policy %q",
+						declaration,
+						name,
+						owners[defined],
+					))
+				}
+			}
+			return findings
+		},
+	}
+}
+
+var circleciPackagePath = ast.MustParseRef("data.circleci")
+
+// HelperImports reports references to circleci helpers that are not loaded because no policy of the bundle
+// imports them, e.g. data.circleci.config.orbs without import data.circleci.config. Such references are
+// always undefined.
+func HelperImports() BundleLintRule {
+	return BundleLintRule{
+		ID:          "helper-import",
+		Description: "CircleCI helpers must be imported to be used",
+		Severity:    SeverityError,
+		Check: func(bundle LintBundle) []LintFinding {
+			compiler := bundle.Compiler
+			if compiler == nil {
+				return nil
+			}
+
+			var findings []LintFinding
+			for _, policy := range sortedKeys(bundle.Modules) {
+				mod, ok := compiler.Modules[policy]
+				if !ok {
+					continue
+				}
+				reported := make(map[string]struct{})
+				ast.WalkTerms(mod, func(term *ast.Term) bool {
+					ref, ok := term.Value.(ast.Ref)
+					if !ok || !ref.HasPrefix(circleciPackagePath) || len(ref) <= len(circleciPackagePath)+1 {
+						return false
+					}
+					prefix := ref.GroundPrefix()
+					if len(compiler.GetRulesWithPrefix(prefix)) > 0 {
+						return false
+					}
+					if _, ok := reported[prefix.String()]; ok {
+						return false
+					}
+					reported[prefix.String()] = struct{}{}
+					findings = append(findings, findingAt(
+						term.Location,
+						"%s is undefined: import %s to use circleci helpers",
+						prefix,
+						ref[:len(circleciPackagePath)+1],
+					))
+					return false
+				})
+			}
+			return findings
+		},
+	}
+}
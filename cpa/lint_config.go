@@ -0,0 +1,278 @@
+package cpa
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"gopkg.in/yaml.v3"
+)
+
+// LintConfigFile is the name of the lint configuration file looked up by LoadPolicyFromFS.
+const LintConfigFile = ".cpa-lint.yaml"
+
+// LintConfig selects the lint rules run against a bundle and the severity of their findings, e.g.:
+//
+//	rules:
+//	  unused-rule:
+//	    severity: error
+//	  duplicate-rule:
+//	    enabled: false
+//	overrides:
+//	  - paths: ["legacy/**"]
+//	    rules:
+//	      disallow-meta-branch:
+//	        severity: warning
+//
+// Overrides apply to the findings of files matching one of their paths, relative to the configuration file.
+// A later override takes precedence over an earlier one. Findings can also be suppressed inline with a
+// "# cpa:lint-ignore <rule>..." comment on the offending line or on the line above it.
+type LintConfig struct {
+	Rules     map[string]LintRuleConfig `yaml:"rules,omitempty"`
+	Overrides []LintOverride            `yaml:"overrides,omitempty"`
+
+	// dir is the directory of the configuration file override paths are relative to.
+	dir string
+}
+
+type LintRuleConfig struct {
+	Enabled  *bool    `yaml:"enabled,omitempty"`
+	Severity Severity `yaml:"severity,omitempty"`
+}
+
+type LintOverride struct {
+	Paths []string                  `yaml:"paths"`
+	Rules map[string]LintRuleConfig `yaml:"rules"`
+}
+
+// DefaultLintConfig returns the configuration used by ParseBundle when none is given: every lint rule
+// enabled with its default severity, except for the formatting rule which is opt-in.
+func DefaultLintConfig() LintConfig {
+	config := LintConfig{Rules: make(map[string]LintRuleConfig)}
+	enabled := true
+	for _, rule := range defaultLintRules(parseOptions{}) {
+		config.Rules[rule.ID] = LintRuleConfig{Enabled: &enabled, Severity: rule.Severity}
+	}
+	for _, rule := range defaultBundleLintRules() {
+		config.Rules[rule.ID] = LintRuleConfig{Enabled: &enabled, Severity: rule.Severity}
+	}
+	disabled := false
+	config.Rules[formattingRuleID] = LintRuleConfig{Enabled: &disabled, Severity: SeverityWarning}
+	return config
+}
+
+// LoadLintConfig reads a lint configuration file. Rules it does not mention keep their default configuration.
+func LoadLintConfig(file string) (LintConfig, error) {
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return LintConfig{}, fmt.Errorf("failed to read lint config: %w", err)
+	}
+
+	var fileConfig LintConfig
+	if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+		return LintConfig{}, fmt.Errorf("failed to parse lint config %q: %w", file, err)
+	}
+
+	config := DefaultLintConfig()
+	config.dir = filepath.Dir(file)
+	config.Overrides = fileConfig.Overrides
+
+	for id, rule := range fileConfig.Rules {
+		if _, ok := config.Rules[id]; !ok {
+			return LintConfig{}, fmt.Errorf("invalid lint config %q: unknown rule %q", file, id)
+		}
+		config.Rules[id] = config.Rules[id].merge(rule)
+	}
+
+	if err := config.validate(); err != nil {
+		return LintConfig{}, fmt.Errorf("invalid lint config %q: %w", file, err)
+	}
+
+	return config, nil
+}
+
+// findLintConfig looks for a lint configuration file in the policy root dir. Parent directories are not searched:
+// a configuration file found above the policies, e.g. in a home directory or a monorepo root, would otherwise
+// silently change their lint results.
+func findLintConfig(dir string) (string, error) {
+	file := filepath.Join(dir, LintConfigFile)
+	if _, err := os.Stat(file); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return file, nil
+}
+
+func (config LintConfig) validate() error {
+	validSeverity := func(severity Severity) bool {
+		switch severity {
+		case "", SeverityError, SeverityWarning, SeverityInfo:
+			return true
+		default:
+			return false
+		}
+	}
+	for id, rule := range config.Rules {
+		if !validSeverity(rule.Severity) {
+			return fmt.Errorf("rule %q: invalid severity %q", id, rule.Severity)
+		}
+	}
+	for _, override := range config.Overrides {
+		for id, rule := range override.Rules {
+			if !validSeverity(rule.Severity) {
+				return fmt.Errorf("override rule %q: invalid severity %q", id, rule.Severity)
+			}
+		}
+	}
+	return nil
+}
+
+func (rule LintRuleConfig) merge(other LintRuleConfig) LintRuleConfig {
+	if other.Enabled != nil {
+		rule.Enabled = other.Enabled
+	}
+	if other.Severity != "" {
+		rule.Severity = other.Severity
+	}
+	return rule
+}
+
+// rules returns the lint rules and bundle lint rules enabled by the configuration.
+// A rule disabled globally can still be enabled for some paths by an override.
+func (config LintConfig) rules(options parseOptions) ([]LintRule, []BundleLintRule) {
+	var rules []LintRule
+	for _, rule := range append(defaultLintRules(options), Formatting()) {
+		if config.mayRun(rule.ID) {
+			rules = append(rules, rule)
+		}
+	}
+	var bundleRules []BundleLintRule
+	for _, rule := range defaultBundleLintRules() {
+		if config.mayRun(rule.ID) {
+			bundleRules = append(bundleRules, rule)
+		}
+	}
+	return rules, bundleRules
+}
+
+func (config LintConfig) mayRun(id string) bool {
+	if rule := config.Rules[id]; rule.Enabled == nil || *rule.Enabled {
+		return true
+	}
+	for _, override := range config.Overrides {
+		if rule := override.Rules[id]; rule.Enabled != nil && *rule.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleFor returns the configuration of a rule for the given file.
+func (config LintConfig) ruleFor(id, file string) LintRuleConfig {
+	rule := config.Rules[id]
+	for _, override := range config.Overrides {
+		if config.matches(override.Paths, file) {
+			rule = rule.merge(override.Rules[id])
+		}
+	}
+	return rule
+}
+
+func (config LintConfig) matches(patterns []string, file string) bool {
+	if config.dir != "" {
+		if rel, err := filepath.Rel(config.dir, file); err == nil {
+			file = rel
+		}
+	}
+	file = filepath.ToSlash(file)
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if file == prefix || strings.HasPrefix(file, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply drops the findings disabled for their file or suppressed inline, and sets the configured severity of
+// the remaining ones. Findings of unconfigured rules, such as parse errors, keep their severity.
+func (config LintConfig) apply(report LintReport, modules map[string]*ast.Module) LintReport {
+	ignored := make(map[string]map[int][]string)
+	for _, mod := range modules {
+		if mod.Package.Location == nil {
+			continue
+		}
+		ignored[mod.Package.Location.File] = lintIgnores(mod.Comments)
+	}
+
+	result := make(LintReport, 0, len(report))
+	for _, finding := range report {
+		if isIgnored(ignored[finding.File], finding) {
+			continue
+		}
+		if _, ok := config.Rules[finding.Rule]; ok {
+			rule := config.ruleFor(finding.Rule, finding.File)
+			if rule.Enabled != nil && !*rule.Enabled {
+				continue
+			}
+			if rule.Severity != "" {
+				finding.Severity = rule.Severity
+			}
+		}
+		result = append(result, finding)
+	}
+	return result
+}
+
+var lintIgnoreExpr = regexp.MustCompile(`^\s*cpa:lint-ignore\b(.*)$`)
+
+// lintIgnores returns the rules ignored by "# cpa:lint-ignore" comments keyed by the row of the comment.
+// An empty list ignores every rule.
+func lintIgnores(comments []*ast.Comment) map[int][]string {
+	result := make(map[int][]string)
+	for _, comment := range comments {
+		match := lintIgnoreExpr.FindSubmatch(comment.Text)
+		if match == nil {
+			continue
+		}
+		rules := strings.FieldsFunc(string(match[1]), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		result[comment.Location.Row] = append(rules, result[comment.Location.Row]...)
+		if len(rules) == 0 {
+			result[comment.Location.Row] = []string{}
+		}
+	}
+	return result
+}
+
+func isIgnored(ignores map[int][]string, finding LintFinding) bool {
+	for _, row := range []int{finding.Row, finding.Row - 1} {
+		rules, ok := ignores[row]
+		if !ok {
+			continue
+		}
+		if len(rules) == 0 {
+			return true
+		}
+		for _, rule := range rules {
+			if rule == finding.Rule {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package cpa
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/format"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FixResult holds the files rewritten by Fix.
+type FixResult struct {
+	// Files are the rewritten, formatted sources of the files that had a fixable finding, keyed by file name.
+	Files map[string]string
+	// Fixed are the findings resolved by the rewrite.
+	Fixed LintReport
+
+	original map[string]string
+}
+
+// Diffs returns the unified diff of every rewritten file keyed by file name.
+func (result FixResult) Diffs() map[string]string {
+	diffs := make(map[string]string, len(result.Files))
+	for file, fixed := range result.Files {
+		diffs[file] = unifiedDiff(file, result.original[file], fixed)
+	}
+	return diffs
+}
+
+// Diff returns the unified diffs of all rewritten files, ordered by file name.
+func (result FixResult) Diff() string {
+	diffs := result.Diffs()
+	var sb strings.Builder
+	for _, file := range sortedKeys(diffs) {
+		sb.WriteString(diffs[file])
+	}
+	return sb.String()
+}
+
+// Fix rewrites the files of the bundle with a finding of a lint rule that supplies a fix, such as
+// DisallowMetaBranch. Rules and suppressions come from the lint configuration, as for Lint. Rewritten files are
+// formatted with the OPA formatter. Files without fixable findings are left out of the result.
+func Fix(bundle map[string]string, opts ...ParseOption) (FixResult, error) {
+	opts = append([]ParseOption{WithLintConfig(DefaultLintConfig())}, opts...)
+	options := newParseOptions(opts)
+
+	rules, _ := options.lintConfig.rules(options)
+	fixers := make(map[string]LintRule, len(rules))
+	for _, rule := range rules {
+		if rule.Fix != nil {
+			fixers[rule.ID] = rule
+		}
+	}
+
+	var multiErr MultiError
+
+	// Modules are keyed by policy name, or by file name when they do not declare a valid one.
+	modules := make(map[string]*ast.Module, len(bundle))
+	files := make(map[string]*ast.Module, len(bundle))
+	for file, rego := range bundle {
+		mod, err := parseModule(file, rego, options)
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to parse file %q: %w", file, err))
+			continue
+		}
+		name, err := parsePolicyName(mod)
+		if err != nil {
+			name = file
+		}
+		modules[name] = mod
+		files[file] = mod
+	}
+
+	if len(multiErr) > 0 {
+		return FixResult{}, fmt.Errorf("failed to parse policy file(s): %w", multiErr)
+	}
+
+	result := FixResult{Files: make(map[string]string), original: bundle}
+
+	report := options.lintConfig.apply(lintModules(modules, slices.Collect(maps.Values(fixers))), modules)
+	fixed := make(map[string]struct{})
+	for _, finding := range report {
+		if !fixers[finding.Rule].Fix(files[finding.File], finding) {
+			continue
+		}
+		result.Fixed = append(result.Fixed, finding)
+		fixed[finding.File] = struct{}{}
+	}
+
+	for file := range fixed {
+		source, err := format.AstWithOpts(files[file], format.Opts{RegoVersion: files[file].RegoVersion()})
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to format file %q: %w", file, err))
+			continue
+		}
+		result.Files[file] = string(source)
+	}
+
+	if len(multiErr) > 0 {
+		return FixResult{}, fmt.Errorf("failed to fix policy file(s): %w", multiErr)
+	}
+
+	return result, nil
+}
+
+// termAt returns the term of the module located at the finding whose value prints as text, or nil.
+func termAt(mod *ast.Module, finding LintFinding, text string) *ast.Term {
+	var result *ast.Term
+	ast.WalkTerms(mod, func(term *ast.Term) bool {
+		if result != nil {
+			return true
+		}
+		if loc := term.Location; loc != nil && loc.Row == finding.Row && loc.Col == finding.Col && term.String() == text {
+			result = term
+			return true
+		}
+		return false
+	})
+	return result
+}
+
+func unifiedDiff(file, a, b string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(a),
+		FromFile: file,
+		B:        splitLines(b),
+		ToFile:   file,
+		Context:  3,
+	})
+	return diff
+}
+
+// splitLines splits source into lines that keep their line break. Unlike difflib.SplitLines, a source ending
+// with a line break has no trailing empty line.
+func splitLines(source string) []string {
+	lines := strings.SplitAfter(source, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,360 @@
+package cpa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	report := Lint(map[string]string{
+		"bad.rego": "package evil\npolicy_name[\"bad\"]\n",
+		"branch.rego": `package org
+policy_name["branch"]
+enable_rule["rule"]
+enable_rule["other"]
+rule {
+	data.meta.branch == "main"
+}
+other {
+	data.meta.branch == "dev"
+}
+`,
+		"invalid.rego": "Invalid Content",
+		"good.rego":    "package org\npolicy_name[\"good\"]\n",
+	})
+
+	require.Equal(t, LintReport{
+		{
+			Rule:     "allowed-packages",
+			Severity: SeverityError,
+			Message:  `invalid package name: expected one of packages [org, lib.*] but got "package evil"`,
+			Policy:   "bad",
+			File:     "bad.rego",
+			Row:      1,
+			Col:      1,
+		},
+		{
+			Rule:     "disallow-meta-branch",
+			Severity: SeverityError,
+			Message:  "invalid use of data.meta.branch use data.meta.vcs.branch instead",
+			Policy:   "branch",
+			File:     "branch.rego",
+			Row:      6,
+			Col:      2,
+			Fixable:  true,
+		},
+		{
+			Rule:     "disallow-meta-branch",
+			Severity: SeverityError,
+			Message:  "invalid use of data.meta.branch use data.meta.vcs.branch instead",
+			Policy:   "branch",
+			File:     "branch.rego",
+			Row:      9,
+			Col:      2,
+			Fixable:  true,
+		},
+		{
+			Rule:     "parse",
+			Severity: SeverityError,
+			Message:  "package expected",
+			File:     "invalid.rego",
+			Row:      1,
+			Col:      1,
+		},
+		{
+			Rule:     "parse",
+			Severity: SeverityError,
+			Message:  "var cannot be used for rule name",
+			File:     "invalid.rego",
+			Row:      1,
+			Col:      9,
+		},
+	}, report)
+	require.True(t, report.HasErrors())
+}
+
+func TestLintWarningsDoNotBlockCompilation(t *testing.T) {
+	warnEverything := LintRule{
+		ID:       "warn",
+		Severity: SeverityWarning,
+		Check: func(m *ast.Module) []LintFinding {
+			return []LintFinding{findingAt(m.Package.Location, "warning")}
+		},
+	}
+
+	bundle := map[string]string{"test.rego": "package org\npolicy_name[\"test\"]\n"}
+
+	report := lintBundle(bundle, []LintRule{warnEverything}, nil)
+	require.Len(t, report, 1)
+	require.False(t, report.HasErrors())
+	require.NoError(t, report.Err())
+
+	_, err := parseBundle(bundle, []LintRule{warnEverything}, nil)
+	require.NoError(t, err)
+}
+
+func TestLintEnablement(t *testing.T) {
+	report := lintBundle(map[string]string{
+		"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["contxt_allowlist"]
+enable_hard["context_blocklist"]
+hard_fail["orbs_allowlist"]
+enable_rule[name] { name := "computed" }
+
+context_allowlist = "allowlist"
+context_blocklist = "blocklist"
+project_ids := {"a", "b"}
+reserved[project] { project := project_ids[_] }
+`,
+		"orbs.rego": `package org
+policy_name["orbs"]
+enable_rule["orbs_allowlist"]
+orbs_allowlist = data.org.reserved
+`,
+	}, nil, []BundleLintRule{EnabledRulesDefined(), UnusedRules()})
+
+	require.Equal(t, LintReport{
+		{
+			Rule:     "undefined-enabled-rule",
+			Severity: SeverityError,
+			Message:  `enable_rule references rule "contxt_allowlist" which is not defined in package org`,
+			Policy:   "contexts",
+			File:     "contexts.rego",
+			Row:      3,
+			Col:      13,
+		},
+		{
+			Rule:     "unused-rule",
+			Severity: SeverityWarning,
+			Message:  `rule "context_allowlist" is defined but never enabled`,
+			Policy:   "contexts",
+			File:     "contexts.rego",
+			Row:      8,
+			Col:      1,
+		},
+	}, report)
+
+	_, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["contxt_allowlist"]
+`})
+	require.ErrorContains(t, err, `enable_rule references rule "contxt_allowlist" which is not defined in package org`)
+}
+
+func TestLintEnablementProjectLayer(t *testing.T) {
+	// The file is named as its policy, so the root package is only known from the ProjectLayer option.
+	bundle := map[string]string{
+		"contexts": `package project
+policy_name["contexts"]
+enable_rule["name_is_bob"]
+enable_rule["context_allowlist"]
+context_allowlist = "allowlist"
+unused = "unused"
+`,
+	}
+
+	// Project layers may enable org rules, such as name_is_bob.
+	report := lintBundle(bundle, nil, []BundleLintRule{EnabledRulesDefined(), UnusedRules()}, ProjectLayer())
+	require.Equal(t, LintReport{
+		{
+			Rule:     "unused-rule",
+			Severity: SeverityWarning,
+			Message:  `rule "unused" is defined but never enabled`,
+			File:     "contexts",
+			Row:      6,
+			Col:      1,
+		},
+	}, report)
+
+	_, err := ParseBundle(bundle, ProjectLayer())
+	require.NoError(t, err)
+}
+
+func TestLintBundleRules(t *testing.T) {
+	report := lintBundle(map[string]string{
+		"a.rego": `package org
+policy_name["a"]
+enable_rule["shared"]
+shared = "from a"
+`,
+		"b.rego": `package org
+policy_name["b"]
+hard_fail["shared"]
+shared = "from b"
+orbs := data.circleci.config.orbs
+`,
+	}, nil, []BundleLintRule{DuplicateRules(), ConflictingHardFail(), HelperImports()})
+
+	require.Equal(t, LintReport{
+		{
+			Rule:     "conflicting-hard-fail",
+			Severity: SeverityWarning,
+			Message:  `hard_fail declares rule "shared" as a hard failure but it is defined by policy "a"`,
+			Policy:   "b",
+			File:     "b.rego",
+			Row:      3,
+			Col:      11,
+		},
+		{
+			Rule:     "duplicate-rule",
+			Severity: SeverityWarning,
+			Message:  `rule "shared" is also defined by policy "a"`,
+			Policy:   "b",
+			File:     "b.rego",
+			Row:      4,
+			Col:      1,
+		},
+		{
+			Rule:     "helper-import",
+			Severity: SeverityError,
+			Message:  "data.circleci.config.orbs is undefined: import data.circleci.config to use circleci helpers",
+			Policy:   "b",
+			File:     "b.rego",
+			Row:      5,
+			Col:      9,
+		},
+	}, report)
+
+	_, err := parseBundle(map[string]string{
+		"test.rego": `package org
+import data.circleci.config
+policy_name["test"]
+orbs := config.orbs
+`,
+	}, nil, []BundleLintRule{HelperImports()})
+	require.NoError(t, err)
+}
+
+func TestLintConfig(t *testing.T) {
+	bundle := map[string]string{
+		"policies/branch.rego": `package org
+policy_name["branch"]
+enable_rule["rule"]
+rule {
+	data.meta.branch == "main"
+}
+`,
+		"legacy/branch.rego": `package org
+policy_name["legacy"]
+enable_rule["rule"]
+rule {
+	data.meta.branch == "main"
+}
+leftover = true
+`,
+		"ignored/branch.rego": `package org
+policy_name["ignored"]
+enable_rule["rule"]
+rule {
+	# cpa:lint-ignore disallow-meta-branch
+	data.meta.branch == "main"
+}
+stale = true # cpa:lint-ignore
+`,
+	}
+
+	disabled := false
+	config := DefaultLintConfig()
+	config.Rules["duplicate-rule"] = LintRuleConfig{Enabled: &disabled}
+	config.Rules["unused-rule"] = config.Rules["unused-rule"].merge(LintRuleConfig{Severity: SeverityError})
+	config.Overrides = []LintOverride{{
+		Paths: []string{"legacy/**"},
+		Rules: map[string]LintRuleConfig{"disallow-meta-branch": {Severity: SeverityInfo}},
+	}}
+
+	report := Lint(bundle, WithLintConfig(config))
+
+	type result struct {
+		File     string
+		Rule     string
+		Severity Severity
+	}
+	var results []result
+	for _, finding := range report {
+		results = append(results, result{finding.File, finding.Rule, finding.Severity})
+	}
+
+	require.Equal(t, []result{
+		{"legacy/branch.rego", "disallow-meta-branch", SeverityInfo},
+		{"legacy/branch.rego", "unused-rule", SeverityError},
+		{"policies/branch.rego", "disallow-meta-branch", SeverityError},
+	}, results)
+
+	_, err := ParseBundle(bundle, WithLintConfig(config))
+	require.ErrorIs(t, err, ErrLint)
+	require.ErrorContains(t, err, "policies/branch.rego:5: invalid use of data.meta.branch")
+	require.NotContains(t, err.Error(), "legacy/branch.rego:5")
+	require.NotContains(t, err.Error(), "ignored/branch.rego")
+}
+
+func TestLoadLintConfig(t *testing.T) {
+	config, err := LoadLintConfig("./testdata/lint_config/.cpa-lint.yaml")
+	require.NoError(t, err)
+
+	require.False(t, *config.Rules["unused-rule"].Enabled)
+	require.Equal(t, SeverityWarning, config.Rules["unused-rule"].Severity)
+	require.True(t, *config.Rules["disallow-meta-branch"].Enabled)
+	require.Equal(t, SeverityWarning, config.ruleFor("disallow-meta-branch", "testdata/lint_config/legacy/branch.rego").Severity)
+	require.Equal(t, SeverityError, config.ruleFor("disallow-meta-branch", "testdata/lint_config/branch.rego").Severity)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, LintConfigFile)
+
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n  no-such-rule:\n    enabled: false\n"), 0o600))
+	_, err = LoadLintConfig(file)
+	require.EqualError(t, err, fmt.Sprintf("invalid lint config %q: unknown rule %q", file, "no-such-rule"))
+
+	require.NoError(t, os.WriteFile(file, []byte("rules:\n  unused-rule:\n    severity: fatal\n"), 0o600))
+	_, err = LoadLintConfig(file)
+	require.EqualError(t, err, fmt.Sprintf("invalid lint config %q: rule %q: invalid severity %q", file, "unused-rule", "fatal"))
+}
+
+func TestFix(t *testing.T) {
+	bundle := map[string]string{
+		"branch.rego": `package org
+policy_name["branch"]
+enable_rule["rule"]
+rule = "must run on main"   {
+	data.meta.branch != "main"
+	# cpa:lint-ignore disallow-meta-branch
+	data.meta.branch != "develop"
+}
+`,
+		"good.rego": "package org\npolicy_name[\"good\"]\n",
+	}
+
+	result, err := Fix(bundle)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"branch.rego": `package org
+
+policy_name["branch"]
+
+enable_rule["rule"]
+
+rule = "must run on main" {
+	data.meta.vcs.branch != "main"
+
+	# cpa:lint-ignore disallow-meta-branch
+	data.meta.branch != "develop"
+}
+`,
+	}, result.Files)
+
+	require.Len(t, result.Fixed, 1)
+	require.Equal(t, "branch", result.Fixed[0].Policy)
+	require.Equal(t, 5, result.Fixed[0].Row)
+
+	require.Contains(t, result.Diff(), "--- branch.rego\n+++ branch.rego\n")
+	require.Contains(t, result.Diffs()["branch.rego"], "+\tdata.meta.vcs.branch != \"main\"\n")
+
+	_, err = Fix(map[string]string{"invalid.rego": "Invalid Content"})
+	require.ErrorContains(t, err, `failed to parse policy file(s): failed to parse file "invalid.rego"`)
+}
@@ -0,0 +1,86 @@
+package cpa
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/format"
+)
+
+// Migrate rewrites the rego v0 files of the bundle to rego v1 compatible source, as opa fmt --rego-v1 does:
+// rule bodies gain the if keyword, partial set rules use contains, future.keywords imports are replaced by
+// import rego.v1, and the result is formatted. Migrated files parse with both rego versions. Files already
+// written for rego v1 are returned unchanged.
+func Migrate(bundle map[string]string) (map[string]string, error) {
+	var multiErr MultiError
+
+	result := make(map[string]string, len(bundle))
+	for file, rego := range bundle {
+		migrated, err := migrateSource(file, rego)
+		if err != nil {
+			multiErr = append(multiErr, fmt.Errorf("failed to migrate file %q: %w", file, err))
+			continue
+		}
+		result[file] = migrated
+	}
+
+	if len(multiErr) > 0 {
+		return nil, multiErr
+	}
+
+	return result, nil
+}
+
+// MigrateFS migrates the rego files found at root, as LoadPolicyFromFS finds them, with Migrate and rewrites the
+// files that changed in place. It returns the paths of the rewritten files, including those rewritten before an
+// error occurred. Running the tester with its ValidateMigration option before rewriting the files checks that the
+// migrated policies make the same decisions.
+func MigrateFS(root string) ([]string, error) {
+	bundle, err := readBundle(root)
+	if err != nil {
+		return nil, err
+	}
+
+	migrated, err := Migrate(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	var rewritten []string
+	for _, file := range sortedKeys(migrated) {
+		if migrated[file] == bundle[file] {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to migrate file: %w", err)
+		}
+		if err := os.WriteFile(filepath.Clean(file), []byte(migrated[file]), info.Mode().Perm()); err != nil {
+			return rewritten, fmt.Errorf("failed to migrate file: %w", err)
+		}
+		rewritten = append(rewritten, file)
+	}
+
+	return rewritten, nil
+}
+
+func migrateSource(file, rego string) (string, error) {
+	mod, err := parseModule(file, rego, parseOptions{version: ast.RegoV0})
+	if err != nil {
+		return "", err
+	}
+	if mod.RegoVersion() != ast.RegoV0 {
+		return rego, nil
+	}
+	migrated, err := format.AstWithOpts(mod, format.Opts{RegoVersion: ast.RegoV0CompatV1})
+	if err != nil {
+		return "", err
+	}
+	// v0 keywords are plain identifiers unless imported, which rewriting can turn into invalid source.
+	if _, err := ast.ParseModuleWithOpts(file, string(migrated), ast.ParserOptions{RegoVersion: ast.RegoV1}); err != nil {
+		return "", fmt.Errorf("migrated source is invalid: %w", err)
+	}
+	return string(migrated), nil
+}
@@ -0,0 +1,123 @@
+package cpa
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/stretchr/testify/require"
+)
+
+const regoV0Policy = `package org
+
+import future.keywords.in
+
+policy_name["branches"]
+
+enable_rule["main_only"]
+
+hard_fail["main_only"]
+
+main_only = "must run on main" {
+	not data.meta.vcs.branch in {"main"}
+}
+`
+
+const regoV1Policy = `package org
+
+import rego.v1
+
+policy_name contains "branches"
+
+enable_rule contains "main_only"
+
+hard_fail contains "main_only"
+
+main_only := "must run on main" if {
+	not data.meta.vcs.branch in {"main"}
+}
+`
+
+func TestMigrate(t *testing.T) {
+	migrated, err := Migrate(map[string]string{"v0.rego": regoV0Policy, "v1.rego": "package org\n\nx if true\n"})
+	require.NoError(t, err)
+	require.Equal(t, "package org\n\nx if true\n", migrated["v1.rego"])
+	require.Equal(t, regoV1Policy, migrated["v0.rego"])
+
+	for _, version := range []ast.RegoVersion{ast.RegoV0, ast.RegoV1} {
+		_, err := ast.ParseModuleWithOpts("v0.rego", migrated["v0.rego"], ast.ParserOptions{RegoVersion: version})
+		require.NoError(t, err, version.String())
+	}
+
+	ctx := context.Background()
+	for _, meta := range []map[string]any{
+		{"vcs": map[string]any{"branch": "main"}},
+		{"vcs": map[string]any{"branch": "dev"}},
+	} {
+		original, err := ParseBundle(map[string]string{"policy.rego": regoV0Policy})
+		require.NoError(t, err)
+		rewritten, err := ParseBundle(map[string]string{"policy.rego": regoV0Policy}, MigrateToV1())
+		require.NoError(t, err)
+
+		expected, err := original.Decide(ctx, map[string]any{}, Meta(meta))
+		require.NoError(t, err)
+		actual, err := rewritten.Decide(ctx, map[string]any{}, Meta(meta))
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	_, err = Migrate(map[string]string{"invalid.rego": "Invalid Content"})
+	require.ErrorContains(t, err, `failed to migrate file "invalid.rego"`)
+
+	// Without importing future.keywords.if, v0 reads "if" as the name of a rule.
+	_, err = Migrate(map[string]string{"keyword.rego": "package org\n\nx = true if { input.x }\n"})
+	require.ErrorContains(t, err, `failed to migrate file "keyword.rego": migrated source is invalid`)
+}
+
+func TestMigrateFS(t *testing.T) {
+	dir := t.TempDir()
+	v0, v1 := filepath.Join(dir, "v0.rego"), filepath.Join(dir, "v1.rego")
+	require.NoError(t, os.WriteFile(v0, []byte(regoV0Policy), 0o600))
+	require.NoError(t, os.WriteFile(v1, []byte(regoV1Policy), 0o600))
+
+	rewritten, err := MigrateFS(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{v0}, rewritten)
+
+	data, err := os.ReadFile(v0)
+	require.NoError(t, err)
+	require.Equal(t, regoV1Policy, string(data))
+}
+
+func TestRegoVersion(t *testing.T) {
+	v1 := `package org
+
+policy_name contains "v1"
+
+enable_rule contains "rule"
+
+rule := "always" if input.version
+`
+
+	t.Run("detects v1 files in a v0 bundle", func(t *testing.T) {
+		policy, err := ParseBundle(map[string]string{"v0.rego": regoV0Policy, "v1.rego": v1})
+		require.NoError(t, err)
+
+		input := map[string]any{"version": 2.1}
+		decision, err := policy.Decide(context.Background(), input, Meta(map[string]any{"vcs": map[string]any{"branch": "main"}}))
+		require.NoError(t, err)
+		require.Equal(t, StatusSoftFail, decision.Status)
+		require.Equal(t, []string{"main_only", "rule"}, decision.EnabledRules)
+	})
+
+	t.Run("v1 bundle", func(t *testing.T) {
+		_, err := ParseBundle(map[string]string{"test.rego": v1, "v0.rego": regoV0Policy}, RegoVersion(ast.RegoV1))
+		require.NoError(t, err)
+	})
+
+	t.Run("formats with the detected version", func(t *testing.T) {
+		require.Equal(t, v1, Format(map[string]string{"v1.rego": v1})["v1.rego"])
+	})
+}
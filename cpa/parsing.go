@@ -3,6 +3,7 @@ package cpa
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"regexp"
 	"strings"
 
@@ -11,12 +12,25 @@ import (
 	"github.com/open-policy-agent/opa/ast"
 
 	"github.com/CircleCI-Public/circle-policy-agent/internal/helpers"
+	"github.com/CircleCI-Public/circle-policy-agent/internal/schemas"
 )
 
 const policyName = "policy_name"
 
 var policyNameExpr = regexp.MustCompile(`^\w+$`)
 
+// libraryKeyPrefix prefixes the file name of library modules in the module map. Policy names are words, so the key
+// of a library module never collides with the policy name of another module.
+const libraryKeyPrefix = "library:"
+
+func libraryKey(file string) string {
+	return libraryKeyPrefix + file
+}
+
+func isLibraryKey(key string) bool {
+	return strings.HasPrefix(key, libraryKeyPrefix)
+}
+
 func parsePolicyName(m *ast.Module) (string, error) {
 	if len(m.Rules) == 0 {
 		return "", fmt.Errorf("must declare rule %q but module contains no rules", policyName)
@@ -62,21 +76,77 @@ func hasImport(mods map[string]*ast.Module, importPath string) bool {
 	return false
 }
 
+// parseModule parses a rego file with the bundle's rego version, falling back to the other version when the
+// file only parses with that one. METADATA annotations that fail to parse are ignored, as they were before
+// annotations were processed, so that a malformed comment block does not break a policy that parsed before.
+func parseModule(file, rego string, options parseOptions) (*ast.Module, error) {
+	version := options.regoVersion()
+	other := ast.RegoV1
+	if version == ast.RegoV1 {
+		other = ast.RegoV0
+	}
+
+	var firstErr error
+	for _, version := range []ast.RegoVersion{version, other} {
+		for _, annotations := range []bool{true, false} {
+			mod, err := ast.ParseModuleWithOpts(file, rego, ast.ParserOptions{ProcessAnnotation: annotations, RegoVersion: version})
+			if err == nil {
+				return mod, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return nil, firstErr
+}
+
 // parseBundle will parse multiple rego files together into a bundle
-func parseBundle(bundle map[string]string, rules ...LintRule) (*Policy, error) {
+func parseBundle(
+	bundle map[string]string,
+	rules []LintRule,
+	bundleRules []BundleLintRule,
+	opts ...ParseOption,
+) (*Policy, error) {
+	options := newParseOptions(opts)
+
+	if options.getDomain().Root == "" {
+		return nil, fmt.Errorf("domain %q has no root package", options.getDomain().Name)
+	}
+	if options.packageName() == "" {
+		return nil, fmt.Errorf("domain %q has no project layer", options.getDomain().Name)
+	}
+
+	if options.migrateToV1 {
+		migrated, err := Migrate(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate policy file(s): %w", err)
+		}
+		bundle = migrated
+	}
+
 	moduleMap := make(map[string]*ast.Module, len(bundle))
 	source := make(map[string]string, len(bundle))
+	libraries := make(map[string]string)
 	nameCount := make(map[string]uint32, len(bundle))
 
 	var multiErr MultiError
 
 	for file, rego := range bundle {
-		mod, err := ast.ParseModule(file, rego)
+		mod, err := parseModule(file, rego, options)
 		if err != nil {
 			multiErr = append(multiErr, fmt.Errorf("failed to parse file %q: %w", file, err))
 			continue
 		}
 
+		// Library modules are keyed by file name since they do not declare a policy name.
+		if options.isLibrary(mod) {
+			moduleMap[libraryKey(file)] = mod
+			libraries[file] = rego
+			continue
+		}
+
 		name, err := parsePolicyName(mod)
 		if err != nil {
 			multiErr = append(multiErr, fmt.Errorf("failed to parse file: %q: %w", file, err))
@@ -102,18 +172,42 @@ func parseBundle(bundle map[string]string, rules ...LintRule) (*Policy, error) {
 		return nil, fmt.Errorf("failed to parse bundle: %w", multiErr)
 	}
 
-	for policyName, mod := range moduleMap {
-		for _, rule := range rules {
-			if err := rule(mod); err != nil {
-				multiErr = append(multiErr, fmt.Errorf("%q: %w", policyName, err))
+	if err := options.lintConfig.apply(lintModules(moduleMap, rules), moduleMap).Err(); err != nil {
+		return nil, fmt.Errorf("failed policy linting: %w", err)
+	}
+
+	policies := maps.Clone(moduleMap)
+	catalog := parseRules(maps.Collect(func(yield func(string, *ast.Module) bool) {
+		for name := range source {
+			if !yield(name, moduleMap[name]) {
+				return
 			}
 		}
+	}))
+
+	compiler := compileModules(moduleMap, options)
+	if compiler.Failed() {
+		return nil, fmt.Errorf("failed to compile policy: %w", compiler.Errors)
 	}
 
-	if len(multiErr) > 0 {
-		return nil, fmt.Errorf("failed policy linting: %w", multiErr)
+	if err := options.lintConfig.apply(lintModuleMap(LintBundle{Root: options.packagePath(), Project: options.project, Modules: policies, Compiler: compiler}, bundleRules), policies).Err(); err != nil {
+		return nil, fmt.Errorf("failed policy linting: %w", err)
 	}
 
+	return &Policy{
+		compiler:  compiler,
+		source:    source,
+		libraries: libraries,
+		rules:     catalog,
+		domain:    options.getDomain(),
+		project:   options.project,
+		options:   options,
+	}, nil
+}
+
+// compileModules adds the circleci helpers imported by the modules to the module map and compiles it.
+// The returned compiler must be checked for errors.
+func compileModules(moduleMap map[string]*ast.Module, options parseOptions) *ast.Compiler {
 	if hasImport(moduleMap, "data.circleci.config") {
 		helpers.AppendHelpers(moduleMap, helpers.Config)
 	}
@@ -140,19 +234,36 @@ func parseBundle(bundle map[string]string, rules ...LintRule) (*Policy, error) {
 		WithCapabilities(capabilities).
 		WithStrict(true)
 
-	if compiler.Compile(moduleMap); compiler.Failed() {
-		return nil, fmt.Errorf("failed to compile policy: %w", compiler.Errors)
+	if options.typeCheck {
+		domain, pkg := options.getDomain(), options.packageName()
+		set := ast.NewSchemaSet()
+		if domain.InputSchema != nil {
+			set.Put(schemas.InputRef, domain.InputSchema)
+		}
+		if domain.MetaSchema != nil {
+			set.Put(schemas.MetaRef, domain.MetaSchema)
+			moduleMap[schemas.ModuleName(pkg)] = schemas.Module(pkg)
+		}
+		compiler = compiler.WithSchemas(set).WithUseTypeCheckAnnotations(true)
 	}
 
-	return &Policy{compiler, source}, nil
+	compiler.Compile(moduleMap)
+
+	return compiler
 }
 
-// ParseBundle will restrict package name to 'org'. This allows us to more easily extract information from the OPA output after evaluating a
-// policy, because we know what the keys will be in the map that contains the results (e.g., map["org"]["enable_rule"] to find enabled rules).
+// ParseBundle parses a bundle of policies declared in the root package of their domain, org for ConfigDomain, or in
+// its project root package when the ProjectLayer option is given, along with library modules of the domain's library
+// packages or of those given with LibraryPackages. Decide reads decisions from that package, e.g. data.org.enable_rule
+// for the enabled rules.
 //
-//nolint:lll
-func ParseBundle(files map[string]string) (*Policy, error) {
-	return parseBundle(files, AllowedPackages("org"), DisallowMetaBranch())
+// The lint rules run against the bundle are selected by the lint configuration, DefaultLintConfig unless
+// WithLintConfig is given.
+func ParseBundle(files map[string]string, opts ...ParseOption) (*Policy, error) {
+	opts = append([]ParseOption{WithLintConfig(DefaultLintConfig())}, opts...)
+	options := newParseOptions(opts)
+	rules, bundleRules := options.lintConfig.rules(options)
+	return parseBundle(files, rules, bundleRules, opts...)
 }
 
 type MultiError []error
@@ -46,7 +46,7 @@ func TestRegoParsing(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			_, err := parseBundle(map[string]string{"test.rego": tc.Document}, tc.LintRules...)
+			_, err := parseBundle(map[string]string{"test.rego": tc.Document}, tc.LintRules, nil)
 			if tc.Error != nil {
 				require.ErrorContains(t, err, tc.Error.Error())
 			} else {
@@ -71,7 +71,7 @@ func TestRegoLinting(t *testing.T) {
 			`,
 			LintRules: []LintRule{AllowedPackages("good", "righteous")},
 			//nolint
-			Error: errors.New(`failed policy linting: "test": invalid package name: expected one of packages [good, righteous] but got "package evil"`),
+			Error: errors.New(`failed policy linting: "test": test.rego:2: invalid package name: expected one of packages [good, righteous] but got "package evil"`),
 		},
 		{
 			Name: "passes package name linting",
@@ -124,7 +124,7 @@ func TestRegoLinting(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			_, err := parseBundle(map[string]string{"test.rego": tc.Document}, tc.LintRules...)
+			_, err := parseBundle(map[string]string{"test.rego": tc.Document}, tc.LintRules, nil)
 			if tc.Error != nil {
 				require.EqualError(t, err, tc.Error.Error())
 				require.True(t, errors.Is(err, ErrLint))
@@ -134,3 +134,91 @@ func TestRegoLinting(t *testing.T) {
 		})
 	}
 }
+
+func TestRegoTypeCheck(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Document string
+		Error    string
+	}{
+		{
+			Name: "passes on known input, compiled and meta properties",
+			Document: `
+				package org
+				policy_name["test"]
+				rule {
+					data.meta.project_id == "id"
+					data.meta.vcs.branch == "main"
+					input.workflows[_].jobs[_][_].context
+					input._compiled_.jobs[_].resource_class
+				}
+			`,
+		},
+		{
+			Name: "passes when using circleci helpers",
+			Document: `
+				package org
+				import data.circleci.config
+				policy_name["test"]
+				enable_rule["contexts"]
+				contexts = config.contexts_allowed_by_project_ids("id", ["ctx"])
+				orbs = config.ban_orbs(["evil"])
+			`,
+		},
+		{
+			Name: "fails on unknown input property",
+			Document: `
+				package org
+				policy_name["test"]
+				rule {
+					input.workflow
+				}
+			`,
+			Error: "test.rego:5: rego_type_error: undefined ref: input.workflow",
+		},
+		{
+			Name: "fails on unknown compiled property",
+			Document: `
+				package org
+				policy_name["test"]
+				rule {
+					input._compiled_.workflowz
+				}
+			`,
+			Error: "test.rego:5: rego_type_error: undefined ref: input._compiled_.workflowz",
+		},
+		{
+			Name: "fails on unknown meta property",
+			Document: `
+				package org
+				policy_name["test"]
+				rule {
+					data.meta.projectid == "id"
+				}
+			`,
+			Error: "test.rego:5: rego_type_error: undefined ref: data.meta.projectid",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := ParseBundle(map[string]string{"test.rego": tc.Document}, TypeCheck())
+			if tc.Error != "" {
+				require.ErrorContains(t, err, tc.Error)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("is opt-in", func(t *testing.T) {
+		_, err := ParseBundle(map[string]string{"test.rego": `
+			package org
+			policy_name["test"]
+			rule {
+				data.meta.projectid == "id"
+			}
+		`})
+		require.NoError(t, err)
+	})
+}
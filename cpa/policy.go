@@ -1,19 +1,28 @@
 package cpa
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/CircleCI-Public/circle-policy-agent/internal"
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/topdown"
 )
 
 type Policy struct {
-	compiler *ast.Compiler
-	source   map[string]string
+	compiler  *ast.Compiler
+	source    map[string]string
+	libraries map[string]string
+	rules     map[string]Rule
+	domain    Domain
+	project   bool
+	options   parseOptions
 }
 
 // Source returns a map of policy_name to normalized rego source code used to build the policy
@@ -21,21 +30,30 @@ func (policy Policy) Source() map[string]string {
 	return policy.source
 }
 
+// Libraries returns a map of file name to rego source code of the library modules of the policy.
+func (policy Policy) Libraries() map[string]string {
+	return policy.libraries
+}
+
 // Modules returns the built module map used in the opa compiler. It includes any circleci rego source
-// imported in the source code.
+// imported in the source code. Library modules are keyed by their file name prefixed with "library:".
 func (policy Policy) Modules() map[string]*ast.Module {
 	return policy.compiler.Modules
 }
 
+// Rules returns the catalog of rules declared by the policies in the bundle, sorted by name, along with
+// the title, description, severity and links of their METADATA annotations.
+// Enablement declarations such as enable_rule and hard_fail and functions are not part of the catalog.
+func (policy Policy) Rules() []Rule {
+	return sortedRules(policy.rules)
+}
+
 // Eval will run native OPA query against your document, input, and apply any evaluation options.
 // It returns raw OPA expression values.
 func (policy Policy) Eval(ctx context.Context, query string, input interface{}, opts ...EvalOption) (interface{}, error) {
 	input = internal.ConvertYAMLMapKeyTypes(input)
 
-	var options evalOptions
-	for _, apply := range opts {
-		apply(&options)
-	}
+	options := newEvalOptions(opts)
 
 	regoOptions := []func(*rego.Rego){
 		rego.Compiler(policy.compiler),
@@ -52,7 +70,12 @@ func (policy Policy) Eval(ctx context.Context, query string, input interface{},
 		return nil, fmt.Errorf("failed to prepare context for evaluation: %w", err)
 	}
 
-	result, err := q.Eval(ctx)
+	var evalOptions []rego.EvalOption
+	if options.clock != nil {
+		evalOptions = append(evalOptions, rego.EvalTime(options.clock()))
+	}
+
+	result, err := q.Eval(ctx, evalOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -72,42 +95,109 @@ func (policy Policy) Eval(ctx context.Context, query string, input interface{},
 }
 
 // Decide takes an input and evaluates it against a policy. Evaluation options will be passed down to policy.Eval
+// Decisions are read from the root package of the policy's domain, data.org for ConfigDomain.
+// When a project policy is layered with the Project option, the decision combines the decisions of both layers.
+// Violations of the baseline given with the WithBaseline option are moved to the baselined violations.
+// A shadow policy given with the Shadow option is evaluated in the background once the live decision is made, and
+// never changes it.
 func (policy Policy) Decide(ctx context.Context, input interface{}, opts ...EvalOption) (*Decision, error) {
+	opts = fixClock(opts)
+	options := newEvalOptions(opts)
+
+	decision, err := policy.decideLayers(ctx, input, options, opts)
+	if err == nil && options.baseline != nil && decision.Status != StatusError {
+		decision.applyBaseline(*options.baseline)
+	}
+	if err == nil && options.shadow != nil && options.shadowReport != nil {
+		options.shadow.decideShadow(ctx, input, decision, opts, options.shadowReport)
+	}
+
+	return decision, err
+}
+
+func (policy Policy) decideLayers(ctx context.Context, input interface{}, options evalOptions, opts []EvalOption) (*Decision, error) {
+	if project := options.project; project != nil {
+		if !project.project {
+			return nil, errors.New("project policy must be parsed with the ProjectLayer option")
+		}
+		if project.domain.Name != policy.domain.Name {
+			return nil, fmt.Errorf("project policy of domain %q cannot be layered on domain %q", project.domain.Name, policy.domain.Name)
+		}
+	}
+
+	decision, _, err := policy.decide(ctx, input, opts...)
+	if err != nil || options.project == nil || decision.Status == StatusError {
+		return decision, err
+	}
+
+	projectDecision, projectHard, err := options.project.decide(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return layerDecisions(decision, projectDecision, projectHard), nil
+}
+
+// Domain returns the domain the policy makes decisions for.
+func (policy Policy) Domain() Domain {
+	return policy.domain
+}
+
+// packageName returns the package the policy reads decisions from.
+func (policy Policy) packageName() string {
+	if policy.project {
+		return policy.domain.ProjectRoot
+	}
+	return policy.domain.Root
+}
+
+// packagePath returns the path of the package the policy reads decisions from, such as data.org.
+func (policy Policy) packagePath() ast.Ref {
+	return packagePath(policy.packageName())
+}
+
+// decide evaluates the policy and returns its decision along with the rules it declares as hard failures, with
+// hard_fail or enable_hard.
+func (policy Policy) decide(ctx context.Context, input interface{}, opts ...EvalOption) (*Decision, map[string]struct{}, error) {
+	options := newEvalOptions(opts)
+
 	if len(policy.compiler.Modules) == 0 {
-		return &Decision{Status: StatusPass}, nil
+		decision := &Decision{Status: StatusPass}
+		decision.suppress(options.suppressions, nil)
+		return decision, nil, nil
 	}
 
+	// Decide fixes the clock, so that schedules and time.now_ns are evaluated at the same time.
+	now := options.now()
+
+	// The whole data document is evaluated, so that an error raised by any rule of the bundle, including library
+	// and helper rules no enabled rule uses, makes an error decision.
 	data, err := policy.Eval(ctx, "data", input, opts...)
 	if err != nil {
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-			return nil, err
+			return nil, nil, err
 		}
-		return &Decision{Status: StatusError, Reason: err.Error()}, nil
-	}
-
-	output, ok := data.(map[string]interface{})
-	if !ok {
-		return nil, errors.New("unexpected opa output")
+		return &Decision{Status: StatusError, Reason: err.Error(), Error: policy.evalError(err)}, nil, nil
 	}
 
-	org, ok := output["org"].(map[string]interface{})
+	org, ok := packageDocument(data, policy.packageName())
 	if !ok {
-		return nil, errors.New("no org policy evaluations found")
+		return nil, nil, fmt.Errorf("no %s policy evaluations found", policy.packageName())
 	}
 
 	enabledRules, err := asStringSlice(org["enable_rule"])
 	if err != nil {
-		return nil, fmt.Errorf("invalid enable_rule: %w", err)
+		return nil, nil, fmt.Errorf("invalid enable_rule: %w", err)
 	}
 
 	hardFailRules, err := asStringSlice(org["hard_fail"])
 	if err != nil {
-		return nil, fmt.Errorf("invalid hard_fail: %w", err)
+		return nil, nil, fmt.Errorf("invalid hard_fail: %w", err)
 	}
 
 	enabledHardFailRules, err := asStringSlice(org["enable_hard"])
 	if err != nil {
-		return nil, fmt.Errorf("invalid enable_hard: %w", err)
+		return nil, nil, fmt.Errorf("invalid enable_hard: %w", err)
 	}
 
 	hardFailRules = append(hardFailRules, enabledHardFailRules...)
@@ -128,28 +218,116 @@ func (policy Policy) Decide(ctx context.Context, input interface{}, opts ...Eval
 		}
 	}
 
+	rollouts, err := asRollouts(org["rollout"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid rollout: %w", err)
+	}
+
+	schedules, err := asSchedules(org["schedule"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	// data.meta is read from the evaluated document, where typed metadata such as map[string]string is normalized.
+	meta, _ := data.(map[string]interface{})["meta"].(map[string]interface{})
+	projectID, _ := meta["project_id"].(string)
+
 	decision := Decision{EnabledRules: enabledRules}
 
 	for _, rule := range enabledRules {
-		if _, ok := hardFailMap[rule]; ok {
-			decision.HardFailures = append(decision.HardFailures, extractViolations(org, rule)...)
+		schedule, scheduled := schedules[rule]
+		if scheduled && !schedule.active(now) {
+			decision.Informational = append(decision.Informational, policy.annotate(extractViolations(org, rule))...)
+			continue
+		}
+		if rollout, ok := rollouts[rule]; ok && !rollout.includes(projectID, options.rolloutBucket) {
+			decision.Informational = append(decision.Informational, policy.annotate(extractViolations(org, rule))...)
+			continue
+		}
+		_, hard := hardFailMap[rule]
+		if hard || (scheduled && schedule.hard(now)) {
+			decision.HardFailures = append(decision.HardFailures, policy.annotate(extractViolations(org, rule))...)
 		} else {
-			decision.SoftFailures = append(decision.SoftFailures, extractViolations(org, rule)...)
+			decision.SoftFailures = append(decision.SoftFailures, policy.annotate(extractViolations(org, rule))...)
 		}
 	}
 
-	switch {
-	case len(decision.HardFailures) > 0:
-		decision.Status = StatusHardFail
-	case len(decision.SoftFailures) > 0:
-		decision.Status = StatusSoftFail
-	default:
-		decision.Status = StatusPass
+	nonSuppressible, err := asStringSlice(org["non_suppressible"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid non_suppressible: %w", err)
+	}
+	if len(options.suppressions) > 0 {
+		nonSuppressibleMap := make(map[string]struct{})
+		for _, rule := range nonSuppressible {
+			nonSuppressibleMap[rule] = struct{}{}
+		}
+		decision.suppress(options.suppressions, nonSuppressibleMap)
+	}
+
+	if options.fingerprints {
+		decision.HardFailures = policy.fingerprint(decision.HardFailures)
+		decision.SoftFailures = policy.fingerprint(decision.SoftFailures)
+		decision.Informational = policy.fingerprint(decision.Informational)
+		decision.Suppressed = policy.fingerprint(decision.Suppressed)
 	}
 
+	decision.updateStatus()
 	decision.sort()
 
-	return &decision, nil
+	return &decision, hardFailMap, nil
+}
+
+// packageDocument returns the document of a package, such as org or admission.context, from the data document.
+func packageDocument(data interface{}, packageName string) (map[string]interface{}, bool) {
+	document, ok := data.(map[string]interface{})
+	for _, segment := range strings.Split(packageName, ".") {
+		if !ok {
+			return nil, false
+		}
+		document, ok = document[segment].(map[string]interface{})
+	}
+	return document, ok
+}
+
+// evalError converts an evaluation error into an EvalError, locating the policy and rule that
+// were being evaluated from the position of OPA's topdown error.
+func (policy Policy) evalError(err error) *EvalError {
+	var topdownErr *topdown.Error
+	if !errors.As(err, &topdownErr) {
+		return &EvalError{Code: topdown.InternalErr, Message: err.Error()}
+	}
+
+	result := &EvalError{Code: topdownErr.Code, Message: topdownErr.Message}
+
+	loc := topdownErr.Location
+	if loc == nil {
+		return result
+	}
+
+	result.Location = location(loc)
+
+	for name, mod := range policy.compiler.Modules {
+		if mod.Package.Location == nil || mod.Package.Location.File != loc.File {
+			continue
+		}
+		if _, ok := policy.source[name]; ok {
+			result.PolicyName = name
+		}
+		for _, rule := range mod.Rules {
+			if rule.Location == nil {
+				continue
+			}
+			start := rule.Location.Row
+			end := start + bytes.Count(rule.Location.Text, []byte("\n"))
+			if loc.Row >= start && loc.Row <= end {
+				result.Rule = ruleName(mod, rule.Ref().GroundPrefix())
+				break
+			}
+		}
+		break
+	}
+
+	return result
 }
 
 func extractViolations(data map[string]interface{}, rule string) []Violation {
@@ -157,20 +335,23 @@ func extractViolations(data map[string]interface{}, rule string) []Violation {
 
 	switch reasonsType := data[rule].(type) {
 	case []interface{}:
-		reasons, err := asStringSlice(reasonsType)
-		if err != nil {
-			break // TODO: should we fail if rules return non string reasons? Should we only report string reasons?
-		}
-		for _, reason := range reasons {
-			violations = append(violations, Violation{Rule: rule, Reason: reason})
+		for _, value := range reasonsType {
+			if violation, ok := asViolation(rule, value); ok {
+				violations = append(violations, violation)
+			}
 		}
 	case map[string]interface{}:
+		// A complete rule may return a single violation object rather than a set of them.
+		if _, ok := reasonsType["reason"].(string); ok {
+			if violation, ok := asViolation(rule, reasonsType); ok {
+				violations = append(violations, violation)
+			}
+			break
+		}
 		for _, value := range reasonsType {
-			reason, ok := value.(string)
-			if !ok {
-				continue // TODO what to do about non-string reasons?
+			if violation, ok := asViolation(rule, value); ok {
+				violations = append(violations, violation)
 			}
-			violations = append(violations, Violation{Rule: rule, Reason: reason})
 		}
 	case string:
 		violations = append(violations, Violation{Rule: rule, Reason: reasonsType})
@@ -179,6 +360,60 @@ func extractViolations(data map[string]interface{}, rule string) []Violation {
 	return violations
 }
 
+// asViolation converts a reason returned by a rule into a violation. A reason is either a string or an object
+// with a string reason and the path of the offending input value, e.g.:
+//
+//	{"reason": "context prod is reserved", "path": ["jobs", "deploy", "context"]}
+//
+// The path is a list of object keys and array indexes, or a dotted string. Other values are ignored.
+func asViolation(rule string, value interface{}) (Violation, bool) {
+	switch value := value.(type) {
+	case string:
+		return Violation{Rule: rule, Reason: value}, true
+	case map[string]interface{}:
+		reason, ok := value["reason"].(string)
+		if !ok {
+			return Violation{}, false
+		}
+		return Violation{Rule: rule, Reason: reason, Path: asPath(value["path"])}, true
+	default:
+		return Violation{}, false
+	}
+}
+
+func asPath(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			return nil
+		}
+		return strings.Split(value, ".")
+	case []interface{}:
+		path := make([]string, 0, len(value))
+		for _, segment := range value {
+			path = append(path, fmt.Sprint(segment))
+		}
+		return path
+	default:
+		return nil
+	}
+}
+
+// annotate copies the METADATA annotations of the violated rules onto their violations.
+func (policy Policy) annotate(violations []Violation) []Violation {
+	for i, violation := range violations {
+		rule, ok := policy.rules[violation.Rule]
+		if !ok {
+			continue
+		}
+		violations[i].Title = rule.Title
+		violations[i].Description = rule.Description
+		violations[i].Severity = rule.Severity
+		violations[i].Links = slices.Clone(rule.Links)
+	}
+	return violations
+}
+
 func asStringSlice(value interface{}) ([]string, error) {
 	if value == nil {
 		return nil, nil
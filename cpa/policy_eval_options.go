@@ -1,7 +1,25 @@
 package cpa
 
+import (
+	"slices"
+	"time"
+)
+
 type evalOptions struct {
 	storage map[string]interface{}
+	project *Policy
+
+	shadow       *Policy
+	shadowReport func(ShadowResult)
+
+	rolloutBucket *int
+	clock         func() time.Time
+
+	fingerprints bool
+	baseline     *Baseline
+
+	configFile   string
+	suppressions []Suppression
 }
 
 type EvalOption func(*evalOptions)
@@ -15,3 +33,98 @@ func Meta(value interface{}) EvalOption {
 		option.storage["meta"] = value
 	}
 }
+
+// Project is an option that layers a project policy, parsed with the ProjectLayer option, on top of the org
+// policy making the decision. The project policy is evaluated with the same input and options. Its rules are
+// added to the org rules: it cannot disable an org rule nor downgrade an org hard failure. Violations of a
+// layered decision name the layer they come from.
+func Project(policy *Policy) EvalOption {
+	return func(option *evalOptions) {
+		option.project = policy
+	}
+}
+
+// Shadow is an option that evaluates a shadow policy, such as a candidate bundle being rolled out, alongside the
+// live policy. The shadow policy decides with the same input and options in the background once the live decision
+// is made, and report is called with both decisions from another goroutine, possibly after Decide returns. The
+// input must therefore not be modified after Decide. The shadow evaluation is not canceled with the context of
+// Decide but bounded by its own timeout. The shadow policy never changes the live decision: its errors are passed
+// to report only.
+func Shadow(policy *Policy, report func(ShadowResult)) EvalOption {
+	return func(option *evalOptions) {
+		option.shadow = policy
+		option.shadowReport = report
+	}
+}
+
+// RolloutBucket is an option that pins the rollout bucket of the decision, between 0 and 99, instead of hashing
+// data.meta.project_id. Tests use it to decide as a project inside or outside of a rollout.
+func RolloutBucket(bucket int) EvalOption {
+	return func(option *evalOptions) {
+		option.rolloutBucket = &bucket
+	}
+}
+
+// Clock is an option that sets the clock rule schedules are evaluated against, and time.now_ns in policies.
+// It defaults to time.Now. Tests use it to pin the time of a decision.
+func Clock(now func() time.Time) EvalOption {
+	return func(option *evalOptions) {
+		option.clock = now
+	}
+}
+
+// Fingerprints is an option that sets the fingerprint of every violation of the decision. A fingerprint is stable
+// for a rule, the policy defining it and the reason of the violation.
+func Fingerprints() EvalOption {
+	return func(option *evalOptions) {
+		option.fingerprints = true
+	}
+}
+
+// WithBaseline is an option that moves the hard and soft failures whose fingerprint is in the baseline to the
+// baselined violations of the decision, so that only new violations fail it. It implies Fingerprints.
+func WithBaseline(baseline Baseline) EvalOption {
+	return func(option *evalOptions) {
+		option.fingerprints = true
+		option.baseline = &baseline
+	}
+}
+
+// ConfigFile is an option that sets the file name of the config located by DecideYAML. It defaults to
+// DefaultConfigFile.
+func ConfigFile(name string) EvalOption {
+	return func(option *evalOptions) {
+		option.configFile = name
+	}
+}
+
+// Suppressions is an option that moves the hard and soft failures suppressed by config comments, as collected by
+// ParseSuppressions, to the suppressed violations of the decision. DecideYAML collects them from its config.
+// Violations of rules declared in non_suppressible are never suppressed.
+func Suppressions(suppressions []Suppression) EvalOption {
+	return func(option *evalOptions) {
+		option.suppressions = append(option.suppressions, suppressions...)
+	}
+}
+
+func newEvalOptions(opts []EvalOption) evalOptions {
+	var options evalOptions
+	for _, apply := range opts {
+		apply(&options)
+	}
+	return options
+}
+
+// fixClock returns the options with the clock fixed to its current time, so that every layer, shadow and input of a
+// decision is evaluated at the same time. The caller's options are left untouched.
+func fixClock(opts []EvalOption) []EvalOption {
+	now := newEvalOptions(opts).now()
+	return append(slices.Clip(opts), Clock(func() time.Time { return now }))
+}
+
+func (options evalOptions) now() time.Time {
+	if options.clock == nil {
+		return time.Now()
+	}
+	return options.clock()
+}
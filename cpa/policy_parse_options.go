@@ -0,0 +1,127 @@
+package cpa
+
+import "github.com/open-policy-agent/opa/ast"
+
+type parseOptions struct {
+	typeCheck   bool
+	lintConfig  LintConfig
+	version     ast.RegoVersion
+	migrateToV1 bool
+	libraries   []string
+	domain      *Domain
+	project     bool
+}
+
+type ParseOption func(*parseOptions)
+
+// TypeCheck is an option that type checks policies at compile time against the bundled CircleCI schemas for
+// input, input._compiled_ and data.meta. References to undefined properties, such as input.workflow or
+// data.meta.projectid, fail compilation with the location of the offending expression.
+func TypeCheck() ParseOption {
+	return func(option *parseOptions) {
+		option.typeCheck = true
+	}
+}
+
+// WithLintConfig is an option that selects the lint rules run by ParseBundle and the severity of their findings.
+// It defaults to DefaultLintConfig, or to the lint configuration file found by LoadPolicyFromFS.
+func WithLintConfig(config LintConfig) ParseOption {
+	return func(option *parseOptions) {
+		option.lintConfig = config
+	}
+}
+
+func newParseOptions(opts []ParseOption) parseOptions {
+	var options parseOptions
+	for _, apply := range opts {
+		apply(&options)
+	}
+	return options
+}
+
+// RegoVersion is an option that sets the rego version of the bundle, ast.RegoV0 by default. The version of each
+// file is still detected: a file that fails to parse with the bundle's version but parses with the other one is
+// read with that version. Files importing rego.v1 are v1 compatible and parse with either version.
+func RegoVersion(version ast.RegoVersion) ParseOption {
+	return func(option *parseOptions) {
+		option.version = version
+	}
+}
+
+// MigrateToV1 is an option that rewrites the v0 files of the bundle to rego v1 compatible source with Migrate
+// before parsing them. It is used to check that migrated policies still make the same decisions.
+func MigrateToV1() ParseOption {
+	return func(option *parseOptions) {
+		option.migrateToV1 = true
+	}
+}
+
+// LibraryPackages is an option that sets the packages of the library modules allowed alongside the policy
+// package, the libraries of the domain by default, e.g. "lib.*". A package ending with ".*" allows every package
+// below it. Library modules hold code shared by policies, which import them as they import data.circleci.utils.
+// They do not declare a policy_name, and their rules are never enabled: Decide only reads decisions from the
+// policy package, such as data.org.
+func LibraryPackages(packages ...string) ParseOption {
+	return func(option *parseOptions) {
+		option.libraries = packages
+	}
+}
+
+// ProjectLayer is an option that parses the bundle as a project layer, evaluated on top of the org bundle with
+// the Project evaluation option. Project policies are declared in the project root of the domain, package project
+// for ConfigDomain, instead of its root.
+func ProjectLayer() ParseOption {
+	return func(option *parseOptions) {
+		option.project = true
+	}
+}
+
+// WithDomain is an option that parses the bundle for a domain other than ConfigDomain. The domain sets the
+// package policies are declared in, the library packages, and the schemas used by TypeCheck.
+func WithDomain(domain Domain) ParseOption {
+	return func(option *parseOptions) {
+		option.domain = &domain
+	}
+}
+
+// getDomain returns the domain of the bundle.
+func (options parseOptions) getDomain() Domain {
+	if options.domain == nil {
+		return ConfigDomain()
+	}
+	return *options.domain
+}
+
+// packageName returns the package policies are declared in, which decisions are read from.
+func (options parseOptions) packageName() string {
+	if options.project {
+		return options.getDomain().ProjectRoot
+	}
+	return options.getDomain().Root
+}
+
+// packagePath returns the path of the package policies are declared in, such as data.org.
+func (options parseOptions) packagePath() ast.Ref {
+	return packagePath(options.packageName())
+}
+
+// libraryPackages returns the packages of library modules.
+func (options parseOptions) libraryPackages() []string {
+	if options.libraries == nil {
+		return options.getDomain().Libraries
+	}
+	return options.libraries
+}
+
+// isLibrary reports whether the module is a library module.
+func (options parseOptions) isLibrary(mod *ast.Module) bool {
+	return matchPackage(mod, options.libraryPackages())
+}
+
+// regoVersion returns the rego version the bundle is parsed and formatted with.
+func (options parseOptions) regoVersion() ast.RegoVersion {
+	if options.version == ast.RegoUndefined {
+		return ast.DefaultRegoVersion
+	}
+	return options.version
+}
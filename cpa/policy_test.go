@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"reflect"
 	"sort"
 	"strings"
@@ -68,7 +69,7 @@ func TestParsePolicy(t *testing.T) {
 				`,
 			},
 			//nolint
-			Error: errors.New(`failed policy linting: "test_1": invalid package name: expected one of packages [org] but got "package bad"`),
+			Error: errors.New(`failed policy linting: "test_1": bad.rego:2: invalid package name: expected one of packages [org, lib.*] but got "package bad"`),
 		},
 		{
 			Name: "Successfully parses policy bundle when helper functions are added to the rego",
@@ -259,7 +260,7 @@ func TestDocumentQuery(t *testing.T) {
 			some name in names;
 			not product[name]
 		}
-	`})
+	`}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to parse rego document for testing: %v", err)
 	}
@@ -333,7 +334,7 @@ func TestBundleQuery(t *testing.T) {
 				not team.product[name]
 			}
 		`,
-	})
+	}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to parse bundle for testing: %v", err)
 	}
@@ -458,7 +459,7 @@ func TestBundleLinksHelpers(t *testing.T) {
 		`, policyName,
 	)
 
-	policy, err := parseBundle(map[string]string{"test.rego": content})
+	policy, err := parseBundle(map[string]string{"test.rego": content}, nil, nil)
 
 	require.NoError(t, err)
 	require.EqualValues(t, content, policy.Source()[policyName])
@@ -538,4 +539,288 @@ func TestPolicyRuntimeError(t *testing.T) {
 		"policy.rego:5: eval_conflict_error: complete rules must not produce multiple outputs",
 		decision.Reason,
 	)
+	require.Equal(
+		t,
+		&EvalError{
+			Code:       "eval_conflict_error",
+			Message:    "complete rules must not produce multiple outputs",
+			Location:   &Location{File: "policy.rego", Row: 5, Col: 4},
+			PolicyName: "http_test",
+			Rule:       "rule",
+		},
+		decision.Error,
+	)
+	require.Equal(t, decision.Reason, decision.Error.Error())
+}
+
+func TestRuleAnnotations(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{
+		"policy.rego": `
+package org
+policy_name["annotated"]
+
+enable_rule["contexts"]
+enable_rule["orbs"]
+hard_fail["orbs"]
+
+# METADATA
+# title: Context allowlist
+# description: Only allowlisted contexts may be used
+# related_resources:
+#   - ref: https://circleci.com/docs/contexts
+#     description: remediation
+# custom:
+#   severity: high
+contexts = "bad context"
+
+orbs = "bad orb"
+`,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []Rule{
+		{
+			Name:        "contexts",
+			Policy:      "annotated",
+			Location:    &Location{File: "policy.rego", Row: 17, Col: 1},
+			Title:       "Context allowlist",
+			Description: "Only allowlisted contexts may be used",
+			Severity:    "high",
+			Links:       []Link{{URL: "https://circleci.com/docs/contexts", Description: "remediation"}},
+		},
+		{
+			Name:     "orbs",
+			Policy:   "annotated",
+			Location: &Location{File: "policy.rego", Row: 19, Col: 1},
+		},
+	}, policy.Rules())
+
+	decision, err := policy.Decide(context.Background(), nil)
+	require.NoError(t, err)
+
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"contexts", "orbs"},
+		HardFailures: []Violation{{Rule: "orbs", Reason: "bad orb"}},
+		SoftFailures: []Violation{
+			{
+				Rule:        "contexts",
+				Reason:      "bad context",
+				Title:       "Context allowlist",
+				Description: "Only allowlisted contexts may be used",
+				Severity:    "high",
+				Links:       []Link{{URL: "https://circleci.com/docs/contexts", Description: "remediation"}},
+			},
+		},
+	}, decision)
+}
+
+func TestLibraryPackages(t *testing.T) {
+	bundle := map[string]string{
+		"policy.rego": `package org
+import data.lib.naming
+policy_name["naming"]
+enable_rule["name_is_upper"]
+name_is_upper = reason {
+	not naming.is_upper(input.name)
+	reason := sprintf("name %q must be upper case", [input.name])
+}
+`,
+		"lib/naming.rego": `package lib.naming
+is_upper(name) { upper(name) == name }
+`,
+	}
+
+	policy, err := ParseBundle(bundle)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{"naming": bundle["policy.rego"]}, policy.Source())
+	require.Equal(t, map[string]string{"lib/naming.rego": bundle["lib/naming.rego"]}, policy.Libraries())
+	require.Equal(t, []string{"name_is_upper"}, func() (names []string) {
+		for _, rule := range policy.Rules() {
+			names = append(names, rule.Name)
+		}
+		return
+	}())
+
+	decision, err := policy.Decide(context.Background(), map[string]any{"name": "bob"})
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusSoftFail,
+		EnabledRules: []string{"name_is_upper"},
+		SoftFailures: []Violation{{Rule: "name_is_upper", Reason: `name "bob" must be upper case`}},
+	}, decision)
+
+	// Library rules are evaluated along with the org rules, even when no enabled rule uses them.
+	broken := maps.Clone(bundle)
+	broken["lib/naming.rego"] += "broken = 1\nbroken = 2\n"
+	policy, err = ParseBundle(broken)
+	require.NoError(t, err)
+
+	decision, err = policy.Decide(context.Background(), map[string]any{"name": "bob"})
+	require.NoError(t, err)
+	require.Equal(t, StatusError, decision.Status)
+	require.Equal(t, "lib/naming.rego", decision.Error.Location.File)
+	require.Equal(t, "broken", decision.Error.Rule)
+
+	// A library file named as a policy does not replace it.
+	named := map[string]string{"naming": bundle["lib/naming.rego"], "policy.rego": bundle["policy.rego"]}
+	policy, err = ParseBundle(named)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"naming": bundle["policy.rego"]}, policy.Source())
+	require.Equal(t, map[string]string{"naming": bundle["lib/naming.rego"]}, policy.Libraries())
+
+	decision, err = policy.Decide(context.Background(), map[string]any{"name": "BOB"})
+	require.NoError(t, err)
+	require.Equal(t, &Decision{Status: StatusPass, EnabledRules: []string{"name_is_upper"}}, decision)
+
+	_, err = ParseBundle(bundle, LibraryPackages("shared"))
+	require.EqualError(t, err, `failed to parse policy file(s): failed to parse file: "lib/naming.rego": `+
+		`first rule declaration must be "policy_name" but found "is_upper"`)
+
+	bundle["lib/naming.rego"] = strings.Replace(bundle["lib/naming.rego"], "package lib.naming", "package shared", 1)
+	bundle["policy.rego"] = strings.Replace(bundle["policy.rego"], "data.lib.naming", "data.shared as naming", 1)
+	_, err = ParseBundle(bundle, LibraryPackages("shared"))
+	require.NoError(t, err)
+}
+
+func TestProjectLayer(t *testing.T) {
+	org, err := ParseBundle(map[string]string{"org.rego": `package org
+policy_name["org"]
+enable_hard["name_is_bob"]
+name_is_bob = "name must be bob!" { input.name != "bob" }
+`})
+	require.NoError(t, err)
+
+	project, err := ParseBundle(map[string]string{"project.rego": `package project
+policy_name["project"]
+enable_rule["name_is_short"]
+enable_rule["name_is_bob"]
+enable_hard["name_is_lower"]
+name_is_short = "name must be short!" { count(input.name) > 3 }
+name_is_lower = "name must be lower case!" { lower(input.name) != input.name }
+`}, ProjectLayer())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	decision, err := org.Decide(ctx, map[string]any{"name": "Alice"}, Project(project))
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"name_is_bob", "name_is_lower", "name_is_short"},
+		HardFailures: []Violation{
+			{Rule: "name_is_bob", Reason: "name must be bob!", Layer: LayerOrg},
+			{Rule: "name_is_lower", Reason: "name must be lower case!", Layer: LayerProject},
+		},
+		SoftFailures: []Violation{
+			{Rule: "name_is_short", Reason: "name must be short!", Layer: LayerProject},
+		},
+	}, decision)
+
+	decision, err = org.Decide(ctx, map[string]any{"name": "bob"}, Project(project))
+	require.NoError(t, err)
+	require.Equal(t, StatusPass, decision.Status)
+
+	decision, err = org.Decide(ctx, map[string]any{"name": "Alice"})
+	require.NoError(t, err)
+	require.Equal(t, []Violation{{Rule: "name_is_bob", Reason: "name must be bob!"}}, decision.HardFailures)
+
+	_, err = org.Decide(ctx, map[string]any{"name": "bob"}, Project(org))
+	require.EqualError(t, err, "project policy must be parsed with the ProjectLayer option")
+
+	_, err = ParseBundle(map[string]string{"project.rego": "package org\npolicy_name[\"project\"]\n"}, ProjectLayer())
+	require.ErrorContains(t, err, `expected one of packages [project, lib.*] but got "package org"`)
+}
+
+func TestProjectLayerTightensOrgRules(t *testing.T) {
+	org, err := ParseBundle(map[string]string{"org.rego": `package org
+policy_name["org"]
+enable_rule["name_is_bob"]
+enable_rule["name_is_short"]
+name_is_bob = "name must be bob!" { input.name != "bob" }
+name_is_short = "name must be short!" { count(input.name) > 3 }
+`})
+	require.NoError(t, err)
+
+	project, err := ParseBundle(map[string]string{"project.rego": `package project
+policy_name["project"]
+hard_fail["name_is_bob"]
+`}, ProjectLayer())
+	require.NoError(t, err)
+
+	decision, err := org.Decide(context.Background(), map[string]any{"name": "Alice"}, Project(project))
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusHardFail,
+		EnabledRules: []string{"name_is_bob", "name_is_short"},
+		HardFailures: []Violation{{Rule: "name_is_bob", Reason: "name must be bob!", Layer: LayerOrg}},
+		SoftFailures: []Violation{{Rule: "name_is_short", Reason: "name must be short!", Layer: LayerOrg}},
+	}, decision)
+}
+
+func TestProjectLayerError(t *testing.T) {
+	org, err := ParseBundle(map[string]string{"org.rego": `package org
+policy_name["org"]
+enable_hard["name_is_bob"]
+name_is_bob = "name must be bob!" { input.name != "bob" }
+`})
+	require.NoError(t, err)
+
+	project, err := ParseBundle(map[string]string{"project.rego": `package project
+policy_name["project"]
+enable_rule["conflict"]
+conflict = "a"
+conflict = "b"
+`}, ProjectLayer())
+	require.NoError(t, err)
+
+	decision, err := org.Decide(context.Background(), map[string]any{"name": "Alice"}, Project(project))
+	require.NoError(t, err)
+	require.Equal(t, StatusError, decision.Status)
+	require.Equal(t, "project", decision.Error.PolicyName)
+	require.Equal(t, []string{"name_is_bob"}, decision.EnabledRules)
+	require.Equal(t, []Violation{{Rule: "name_is_bob", Reason: "name must be bob!", Layer: LayerOrg}}, decision.HardFailures)
+}
+
+func TestRuleAnnotationsAreCopied(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{
+		"policy.rego": `package org
+policy_name["annotated"]
+enable_rule["contexts"]
+
+# METADATA
+# related_resources:
+#   - ref: https://circleci.com/docs/contexts
+contexts["first"]
+contexts["second"]
+`,
+	})
+	require.NoError(t, err)
+
+	decision, err := policy.Decide(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, decision.SoftFailures, 2)
+
+	decision.SoftFailures[0].Links[0].URL = "https://example.com"
+	require.Equal(t, "https://circleci.com/docs/contexts", decision.SoftFailures[1].Links[0].URL)
+	require.Equal(t, "https://circleci.com/docs/contexts", policy.Rules()[0].Links[0].URL)
+}
+
+func TestMalformedAnnotationsAreIgnored(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{
+		"policy.rego": `package org
+policy_name["malformed"]
+enable_rule["contexts"]
+
+# METADATA
+# title: [unterminated
+contexts = "bad context"
+`,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []Rule{
+		{Name: "contexts", Policy: "malformed", Location: &Location{File: "policy.rego", Row: 7, Col: 1}},
+	}, policy.Rules())
 }
@@ -0,0 +1,220 @@
+package cpa
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+var (
+	metaRootRef     = ast.MustParseRef("data.meta")
+	compiledRootRef = ast.MustParseRef("input._compiled_")
+)
+
+// RuleReferences lists the input and data.meta paths read by a rule of the policy package, directly or through the
+// rules and functions it uses, such as the data.circleci.config helpers. Paths are dotted, with * standing for a
+// key or index that is not constant, e.g. input.jobs.*.docker.*.image. Only the most specific paths are listed:
+// reading input.jobs.*.context implies reading input.jobs.
+type RuleReferences struct {
+	Rule   string   `json:"rule"`
+	Policy string   `json:"policy"`
+	Input  []string `json:"input,omitempty"`
+	Meta   []string `json:"meta,omitempty"`
+}
+
+// References walks the compiled policy to list the input and data.meta paths read by each rule of the policy
+// package, including enablement declarations, sorted by rule name. Paths read through a variable bound to an input
+// value, e.g. job := input.jobs[_] or some job in input.jobs, are resolved.
+func (policy Policy) References() []RuleReferences {
+	walker := referenceWalker{compiler: policy.compiler, visited: make(map[*ast.Rule]map[string]struct{})}
+
+	root := policy.packagePath()
+	rules := make(map[string]RuleReferences)
+	paths := make(map[string]map[string]struct{})
+	for _, name := range sortedKeys(policy.source) {
+		mod, ok := policy.compiler.Modules[name]
+		if !ok || !mod.Package.Path.Equal(root) {
+			continue
+		}
+		for _, rule := range mod.Rules {
+			ruleName := ruleName(mod, rule.Head.Ref().GroundPrefix())
+			if ruleName == "" || ruleName == policyName {
+				continue
+			}
+			if _, ok := rules[ruleName]; !ok {
+				rules[ruleName] = RuleReferences{Rule: ruleName, Policy: name}
+				paths[ruleName] = make(map[string]struct{})
+			}
+			for path := range walker.rule(rule) {
+				paths[ruleName][path] = struct{}{}
+			}
+		}
+	}
+
+	result := make([]RuleReferences, 0, len(rules))
+	for _, name := range sortedKeys(rules) {
+		references := rules[name]
+		for _, path := range leafPaths(paths[name]) {
+			if strings.HasPrefix(path, "input") {
+				references.Input = append(references.Input, path)
+			} else {
+				references.Meta = append(references.Meta, path)
+			}
+		}
+		result = append(result, references)
+	}
+	return result
+}
+
+// InputWarnings returns warnings about an input the policy needs more of to decide correctly. It reports the rules
+// reading the compiled config when the input does not provide it under _compiled_: they are then never violated.
+func (policy Policy) InputWarnings(input interface{}) []string {
+	if object, ok := input.(map[string]interface{}); ok {
+		if _, ok := object["_compiled_"]; ok {
+			return nil
+		}
+	}
+
+	var rules []string
+	for _, references := range policy.References() {
+		for _, path := range references.Input {
+			if strings.HasPrefix(path, compiledRootRef.String()) {
+				rules = append(rules, references.Rule)
+				break
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	return []string{fmt.Sprintf(
+		"rules %s read input._compiled_ but the input has no compiled config",
+		strings.Join(rules, ", "),
+	)}
+}
+
+type referenceWalker struct {
+	compiler *ast.Compiler
+	visited  map[*ast.Rule]map[string]struct{}
+}
+
+// rule returns the input and data.meta paths read by a rule and the rules it references.
+func (walker referenceWalker) rule(rule *ast.Rule) map[string]struct{} {
+	if paths, ok := walker.visited[rule]; ok {
+		return paths
+	}
+	paths := make(map[string]struct{})
+	walker.visited[rule] = paths
+
+	// Variables bound to input values, e.g. __local0__ = input.jobs[name], resolve the refs they head.
+	bindings := make(map[ast.Var]ast.Ref)
+	resolve := func(ref ast.Ref) ast.Ref {
+		if head, ok := ref[0].Value.(ast.Var); ok {
+			if bound, ok := bindings[head]; ok {
+				return append(bound.Copy(), ref[1:]...)
+			}
+		}
+		return ref
+	}
+	bind := func(v *ast.Term, value *ast.Term, suffix ...*ast.Term) {
+		name, ok := v.Value.(ast.Var)
+		if !ok {
+			return
+		}
+		ref, ok := value.Value.(ast.Ref)
+		if !ok {
+			return
+		}
+		if ref = resolve(ref); isReadRef(ref) {
+			bindings[name] = append(ref.Copy(), suffix...)
+		}
+	}
+
+	ast.WalkExprs(rule, func(expr *ast.Expr) bool {
+		terms, ok := expr.Terms.([]*ast.Term)
+		if !ok || len(terms) < 3 {
+			return false
+		}
+		switch expr.Operator().String() {
+		case ast.Equality.Name, ast.Assign.Name:
+			bind(terms[1], terms[2])
+			bind(terms[2], terms[1])
+		case ast.Member.Name:
+			bind(terms[1], terms[2], ast.VarTerm("_"))
+		case ast.MemberWithKey.Name:
+			if len(terms) > 3 {
+				bind(terms[2], terms[3], ast.VarTerm("_"))
+			}
+		}
+		return false
+	})
+
+	ast.WalkRefs(rule, func(ref ast.Ref) bool {
+		if ref = resolve(ref); isReadRef(ref) {
+			paths[refPath(ref)] = struct{}{}
+		}
+		return false
+	})
+	for _, used := range walker.usedRules(rule) {
+		for path := range walker.rule(used) {
+			paths[path] = struct{}{}
+		}
+	}
+
+	return paths
+}
+
+// usedRules returns the rules and functions referenced by a rule, such as the other rules of its package or the
+// data.circleci.config helpers.
+func (walker referenceWalker) usedRules(rule *ast.Rule) []*ast.Rule {
+	var used []*ast.Rule
+	ast.WalkRefs(rule, func(ref ast.Ref) bool {
+		if ref.HasPrefix(ast.DefaultRootRef) && !ref.HasPrefix(metaRootRef) {
+			used = append(used, walker.compiler.GetRules(ref.GroundPrefix())...)
+		}
+		return false
+	})
+	return used
+}
+
+func isReadRef(ref ast.Ref) bool {
+	return ref.HasPrefix(ast.InputRootRef) || ref.HasPrefix(metaRootRef)
+}
+
+// refPath formats a ref as a dotted path, with * for its non-constant terms.
+func refPath(ref ast.Ref) string {
+	segments := []string{ref[0].Value.String()}
+	for _, term := range ref[1:] {
+		switch value := term.Value.(type) {
+		case ast.String:
+			segments = append(segments, string(value))
+		case ast.Number:
+			segments = append(segments, value.String())
+		default:
+			segments = append(segments, "*")
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// leafPaths returns the sorted paths that are not a prefix of another path.
+func leafPaths(paths map[string]struct{}) []string {
+	var result []string
+	for path := range paths {
+		leaf := true
+		for other := range paths {
+			if strings.HasPrefix(other, path+".") {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			result = append(result, path)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
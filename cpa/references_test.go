@@ -0,0 +1,47 @@
+package cpa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferences(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"policy.rego": `package org
+import future.keywords
+import data.circleci.config
+policy_name["references"]
+enable_rule["pinned_images"]
+enable_rule["blocked_contexts"]
+enable_rule["no_orbs"]
+hard_fail["no_orbs"] { data.meta.vcs.branch == "main" }
+pinned_images[name] {
+	some name, job in input.jobs
+	image := job.docker[_].image
+	endswith(image, ":latest")
+}
+blocked_contexts = config.contexts_blocked_by_project_ids(["project"], ["prod"])
+no_orbs = "orbs are not allowed" { has_orbs }
+has_orbs { count(input.orbs) > 0 }
+`})
+	require.NoError(t, err)
+
+	require.Equal(t, []RuleReferences{
+		{
+			Rule:   "blocked_contexts",
+			Policy: "references",
+			Input:  []string{"input._compiled_.workflows.*.jobs.*.*.context"},
+			Meta:   []string{"data.meta.project_id"},
+		},
+		{Rule: "enable_rule", Policy: "references"},
+		{Rule: "hard_fail", Policy: "references", Meta: []string{"data.meta.vcs.branch"}},
+		{Rule: "has_orbs", Policy: "references", Input: []string{"input.orbs"}},
+		{Rule: "no_orbs", Policy: "references", Input: []string{"input.orbs"}},
+		{Rule: "pinned_images", Policy: "references", Input: []string{"input.jobs.*.docker.*.image"}},
+	}, policy.References())
+
+	require.Equal(t, []string{
+		"rules blocked_contexts read input._compiled_ but the input has no compiled config",
+	}, policy.InputWarnings(map[string]any{"jobs": map[string]any{}}))
+	require.Empty(t, policy.InputWarnings(map[string]any{"_compiled_": map[string]any{}}))
+}
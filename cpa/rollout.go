@@ -0,0 +1,83 @@
+package cpa
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// rollout is the declaration of a rule enabled for a percentage of projects only, e.g.:
+//
+//	rollout["context_allowlist"] := {"percentage": 10, "salt": "context_allowlist-2024"}
+//
+// A project is in the rollout when its bucket, a hash of the salt and data.meta.project_id between 0 and 99, is
+// below the percentage. Changing the salt reshuffles the projects, while raising the percentage only adds projects
+// to the rollout.
+type rollout struct {
+	percentage float64
+	salt       string
+}
+
+// includes reports whether the project of the decision is in the rollout. Decisions without a project id are only
+// in complete rollouts, unless the bucket is pinned with the RolloutBucket option.
+func (r rollout) includes(projectID string, bucket *int) bool {
+	if bucket != nil {
+		return float64(*bucket) < r.percentage
+	}
+	if r.percentage >= 100 {
+		return true
+	}
+	if projectID == "" {
+		return false
+	}
+	return float64(rolloutBucket(r.salt, projectID)) < r.percentage
+}
+
+// rolloutBucket hashes a project id into one of 100 buckets.
+func rolloutBucket(salt, projectID string) int {
+	sum := sha256.Sum256([]byte(salt + ":" + projectID))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+func asRollouts(value interface{}) (map[string]rollout, error) {
+	if value == nil {
+		return nil, nil
+	}
+	declarations, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("value is not an object")
+	}
+
+	rollouts := make(map[string]rollout, len(declarations))
+	for rule, declaration := range declarations {
+		fields, ok := declaration.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule %q: declaration is not an object", rule)
+		}
+		percentage, err := asNumber(fields["percentage"])
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: invalid percentage: %w", rule, err)
+		}
+		if percentage < 0 || percentage > 100 {
+			return nil, fmt.Errorf("rule %q: percentage %v is not between 0 and 100", rule, percentage)
+		}
+		salt, _ := fields["salt"].(string)
+		rollouts[rule] = rollout{percentage: percentage, salt: salt}
+	}
+	return rollouts, nil
+}
+
+func asNumber(value interface{}) (float64, error) {
+	switch number := value.(type) {
+	case json.Number:
+		return number.Float64()
+	case float64:
+		return number, nil
+	case int:
+		return float64(number), nil
+	default:
+		return 0, errors.New("value is not a number")
+	}
+}
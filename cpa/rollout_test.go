@@ -0,0 +1,79 @@
+package cpa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollout(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+rollout["no_prod"] := {"percentage": 50, "salt": "q1"}
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+	require.NoError(t, err)
+
+	violation := Violation{Rule: "no_prod", Reason: "prod context is reserved"}
+	inRollout := &Decision{Status: StatusHardFail, EnabledRules: []string{"no_prod"}, HardFailures: []Violation{violation}}
+	outOfRollout := &Decision{Status: StatusPass, EnabledRules: []string{"no_prod"}, Informational: []Violation{violation}}
+
+	testCases := []struct {
+		Name     string
+		Options  []EvalOption
+		Expected *Decision
+	}{
+		{
+			Name:     "project in rollout",
+			Options:  []EvalOption{Meta(map[string]any{"project_id": "project-b"})},
+			Expected: inRollout,
+		},
+		{
+			Name:     "project out of rollout",
+			Options:  []EvalOption{Meta(map[string]any{"project_id": "project-a"})},
+			Expected: outOfRollout,
+		},
+		{
+			Name:     "typed meta",
+			Options:  []EvalOption{Meta(map[string]string{"project_id": "project-b"})},
+			Expected: inRollout,
+		},
+		{
+			Name:     "no project",
+			Expected: outOfRollout,
+		},
+		{
+			Name:     "pinned bucket in rollout",
+			Options:  []EvalOption{Meta(map[string]any{"project_id": "project-a"}), RolloutBucket(49)},
+			Expected: inRollout,
+		},
+		{
+			Name:     "pinned bucket out of rollout",
+			Options:  []EvalOption{Meta(map[string]any{"project_id": "project-b"}), RolloutBucket(50)},
+			Expected: outOfRollout,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			decision, err := policy.Decide(context.Background(), map[string]any{"context": "prod"}, tc.Options...)
+			require.NoError(t, err)
+			require.Equal(t, tc.Expected, decision)
+		})
+	}
+
+	t.Run("invalid percentage", func(t *testing.T) {
+		policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+rollout["no_prod"] := {"percentage": 150}
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+		require.NoError(t, err)
+
+		_, err = policy.Decide(context.Background(), map[string]any{})
+		require.EqualError(t, err, `invalid rollout: rule "no_prod": percentage 150 is not between 0 and 100`)
+	})
+}
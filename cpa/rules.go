@@ -0,0 +1,154 @@
+package cpa
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// enablementRules are the rules used to declare a policy and which of its rules are enforced.
+// They are not part of the rule catalog.
+var enablementRules = map[string]struct{}{
+	policyName:         {},
+	"enable_rule":      {},
+	"hard_fail":        {},
+	"enable_hard":      {},
+	"rollout":          {},
+	"schedule":         {},
+	"non_suppressible": {},
+}
+
+// Link is a related resource attached to a rule through its METADATA annotation, such as remediation documentation.
+type Link struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Rule describes a rule declared by a policy, where it is first defined, along with the human-friendly information
+// attached to it through an OPA METADATA comment block:
+//
+//	# METADATA
+//	# title: Context allowlist
+//	# description: Only allowlisted contexts may be used by this project
+//	# related_resources:
+//	#   - ref: https://circleci.com/docs/contexts
+//	#     description: remediation
+//	# custom:
+//	#   severity: high
+//	context_allowlist = ...
+type Rule struct {
+	Name        string    `json:"name"`
+	Policy      string    `json:"policy"`
+	Location    *Location `json:"location,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Severity    string    `json:"severity,omitempty"`
+	Links       []Link    `json:"links,omitempty"`
+}
+
+// parseRules builds the rule catalog of the given policy modules keyed by rule name. When a rule is
+// declared by more than one policy the first annotated declaration wins.
+func parseRules(modules map[string]*ast.Module) map[string]Rule {
+	policies := make([]string, 0, len(modules))
+	for name := range modules {
+		policies = append(policies, name)
+	}
+	slices.Sort(policies)
+
+	rules := make(map[string]Rule)
+
+	for _, policy := range policies {
+		mod := modules[policy]
+
+		for _, rule := range mod.Rules {
+			if len(rule.Head.Args) > 0 {
+				continue
+			}
+			name := ruleName(mod, rule.Ref().GroundPrefix())
+			if _, ok := enablementRules[name]; ok || name == "" {
+				continue
+			}
+			if _, ok := rules[name]; !ok {
+				rules[name] = Rule{Name: name, Policy: policy, Location: location(rule.Location)}
+			}
+		}
+
+		for _, annotation := range mod.Annotations {
+			if annotation.Scope != "rule" && annotation.Scope != "document" {
+				continue
+			}
+			name := ruleName(mod, annotation.GetTargetPath())
+			rule, ok := rules[name]
+			if !ok || rule.annotated() {
+				continue
+			}
+			rules[name] = rule.annotate(annotation)
+		}
+	}
+
+	return rules
+}
+
+// ruleName returns the name of the rule at path relative to the module's package.
+func ruleName(mod *ast.Module, path ast.Ref) string {
+	if len(path) == 0 {
+		return ""
+	}
+	if path.HasPrefix(mod.Package.Path) {
+		path = path[len(mod.Package.Path):]
+	}
+	if len(path) == 0 {
+		return ""
+	}
+	switch value := path[0].Value.(type) {
+	case ast.Var:
+		return string(value)
+	case ast.String:
+		return string(value)
+	default:
+		return path[0].String()
+	}
+}
+
+func location(loc *ast.Location) *Location {
+	if loc == nil {
+		return nil
+	}
+	return &Location{File: loc.File, Row: loc.Row, Col: loc.Col}
+}
+
+func (rule Rule) annotated() bool {
+	return rule.Title != "" || rule.Description != "" || rule.Severity != "" || len(rule.Links) > 0
+}
+
+func (rule Rule) annotate(annotation *ast.Annotations) Rule {
+	rule.Title = annotation.Title
+	rule.Description = annotation.Description
+
+	if severity, ok := annotation.Custom["severity"]; ok {
+		rule.Severity = fmt.Sprint(severity)
+	}
+
+	for _, resource := range annotation.RelatedResources {
+		rule.Links = append(rule.Links, Link{
+			URL:         resource.Ref.String(),
+			Description: resource.Description,
+		})
+	}
+
+	return rule
+}
+
+// sortedRules returns the rule catalog sorted by rule name.
+func sortedRules(rules map[string]Rule) []Rule {
+	result := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, rule)
+	}
+	slices.SortFunc(result, func(a, b Rule) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return result
+}
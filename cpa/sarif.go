@@ -0,0 +1,147 @@
+package cpa
+
+import (
+	"io"
+
+	"github.com/CircleCI-Public/circle-policy-agent/internal/sarif"
+)
+
+const (
+	sarifToolName       = "circle-policy-agent"
+	sarifInformationURI = "https://github.com/CircleCI-Public/circle-policy-agent"
+
+	// evalErrorRuleID is the SARIF rule used to report a decision that failed to evaluate.
+	evalErrorRuleID = "evaluation-error"
+)
+
+var lintSeverityLevels = map[Severity]sarif.Level{
+	SeverityError:   sarif.LevelError,
+	SeverityWarning: sarif.LevelWarning,
+	SeverityInfo:    sarif.LevelNote,
+}
+
+// WriteLintSARIF writes a lint report as a SARIF 2.1.0 log. The rules are used as the log's rule descriptors
+// and default to the lint rules and bundle lint rules used by ParseBundle.
+func WriteLintSARIF(w io.Writer, report LintReport, rules ...LintRule) error {
+	driver := sarif.Driver{Name: sarifToolName, InformationURI: sarifInformationURI}
+
+	if len(rules) > 0 {
+		for _, rule := range rules {
+			driver.Rules = append(driver.Rules, lintDescriptor(rule.ID, rule.Description, rule.Severity))
+		}
+	} else {
+		for _, rule := range append(defaultLintRules(parseOptions{}), Formatting()) {
+			driver.Rules = append(driver.Rules, lintDescriptor(rule.ID, rule.Description, rule.Severity))
+		}
+		for _, rule := range defaultBundleLintRules() {
+			driver.Rules = append(driver.Rules, lintDescriptor(rule.ID, rule.Description, rule.Severity))
+		}
+	}
+
+	known := make(map[string]struct{}, len(driver.Rules))
+	for _, rule := range driver.Rules {
+		known[rule.ID] = struct{}{}
+	}
+
+	// Findings such as parse errors are not produced by a lint rule but still need a descriptor.
+	for _, finding := range report {
+		if _, ok := known[finding.Rule]; ok {
+			continue
+		}
+		known[finding.Rule] = struct{}{}
+		driver.Rules = append(driver.Rules, sarif.ReportingDescriptor{ID: finding.Rule})
+	}
+
+	log := sarif.NewLog(driver)
+	for _, finding := range report {
+		log.AddResult(sarif.Result{
+			RuleID:    finding.Rule,
+			Level:     lintSeverityLevels[finding.Severity],
+			Message:   sarif.Message{Text: finding.Message},
+			Locations: []sarif.Location{sarif.NewLocation(finding.File, finding.Row, finding.Col)},
+		})
+	}
+
+	return log.Encode(w)
+}
+
+// WriteDecisionSARIF writes the violations of a decision as a SARIF 2.1.0 log. Hard failures are reported as errors
+// and soft failures as warnings. The rules, as returned by Policy.Rules, provide the rule descriptors and locate
+// each violation at the definition of the rule that produced it. A decision that failed to evaluate is reported
+// as a single evaluation-error result.
+func WriteDecisionSARIF(w io.Writer, decision *Decision, rules []Rule) error {
+	driver := sarif.Driver{Name: sarifToolName, InformationURI: sarifInformationURI}
+
+	catalog := make(map[string]Rule, len(rules))
+	for _, rule := range rules {
+		catalog[rule.Name] = rule
+		descriptor := sarif.ReportingDescriptor{
+			ID:               rule.Name,
+			Name:             rule.Title,
+			ShortDescription: sarifMessage(rule.Title),
+			FullDescription:  sarifMessage(rule.Description),
+		}
+		if len(rule.Links) > 0 {
+			descriptor.HelpURI = rule.Links[0].URL
+		}
+		if rule.Severity != "" {
+			descriptor.Properties = map[string]any{"severity": rule.Severity}
+		}
+		driver.Rules = append(driver.Rules, descriptor)
+	}
+
+	if decision.Error != nil {
+		driver.Rules = append(driver.Rules, sarif.ReportingDescriptor{
+			ID:               evalErrorRuleID,
+			ShortDescription: sarifMessage("Policy failed to evaluate"),
+		})
+	}
+
+	log := sarif.NewLog(driver)
+
+	if err := decision.Error; err != nil {
+		result := sarif.Result{RuleID: evalErrorRuleID, Level: sarif.LevelError, Message: sarif.Message{Text: err.Error()}}
+		if err.Location != nil {
+			result.Locations = []sarif.Location{sarif.NewLocation(err.Location.File, err.Location.Row, err.Location.Col)}
+		}
+		log.AddResult(result)
+	}
+
+	for _, group := range []struct {
+		level      sarif.Level
+		violations []Violation
+	}{
+		{sarif.LevelError, decision.HardFailures},
+		{sarif.LevelWarning, decision.SoftFailures},
+	} {
+		for _, violation := range group.violations {
+			result := sarif.Result{RuleID: violation.Rule, Level: group.level, Message: sarif.Message{Text: violation.Reason}}
+			// Violations located in the config point to it, others to the definition of their rule.
+			loc := violation.Source
+			if loc == nil {
+				loc = catalog[violation.Rule].Location
+			}
+			if loc != nil {
+				result.Locations = []sarif.Location{sarif.NewLocation(loc.File, loc.Row, loc.Col)}
+			}
+			log.AddResult(result)
+		}
+	}
+
+	return log.Encode(w)
+}
+
+func lintDescriptor(id, description string, severity Severity) sarif.ReportingDescriptor {
+	return sarif.ReportingDescriptor{
+		ID:                   id,
+		ShortDescription:     sarifMessage(description),
+		DefaultConfiguration: &sarif.ReportingConfiguration{Level: lintSeverityLevels[severity]},
+	}
+}
+
+func sarifMessage(text string) *sarif.Message {
+	if text == "" {
+		return nil
+	}
+	return &sarif.Message{Text: text}
+}
@@ -0,0 +1,170 @@
+package cpa
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLintSARIF(t *testing.T) {
+	report := Lint(map[string]string{
+		"test.rego": "package org\npolicy_name[\"test\"]\nenable_rule[\"rule\"]\nrule {\n\tdata.meta.branch == \"main\"\n}\n",
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteLintSARIF(&buf, report, AllowedPackages("org"), DisallowMetaBranch()))
+
+	require.JSONEq(t, `{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": [{
+			"tool": {
+				"driver": {
+					"name": "circle-policy-agent",
+					"informationUri": "https://github.com/CircleCI-Public/circle-policy-agent",
+					"rules": [
+						{
+							"id": "allowed-packages",
+							"shortDescription": {"text": "Policies must be declared in one of the allowed packages"},
+							"defaultConfiguration": {"level": "error"}
+						},
+						{
+							"id": "disallow-meta-branch",
+							"shortDescription": {"text": "data.meta.branch is not provided, data.meta.vcs.branch must be used instead"},
+							"defaultConfiguration": {"level": "error"}
+						}
+					]
+				}
+			},
+			"results": [{
+				"ruleId": "disallow-meta-branch",
+				"ruleIndex": 1,
+				"level": "error",
+				"message": {"text": "invalid use of data.meta.branch use data.meta.vcs.branch instead"},
+				"locations": [{
+					"physicalLocation": {
+						"artifactLocation": {"uri": "test.rego"},
+						"region": {"startLine": 5, "startColumn": 2}
+					}
+				}]
+			}]
+		}]
+	}`, buf.String())
+}
+
+func TestWriteDecisionSARIF(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{
+		"policy.rego": `package org
+policy_name["test"]
+enable_rule["soft"]
+enable_hard["hard"]
+
+# METADATA
+# title: Hard rule
+# related_resources:
+#   - ref: https://example.com/hard
+hard = "hard reason"
+
+soft = "soft reason"
+`,
+	})
+	require.NoError(t, err)
+
+	decision, err := policy.Decide(context.Background(), nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDecisionSARIF(&buf, decision, policy.Rules()))
+
+	require.JSONEq(t, `{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": [{
+			"tool": {
+				"driver": {
+					"name": "circle-policy-agent",
+					"informationUri": "https://github.com/CircleCI-Public/circle-policy-agent",
+					"rules": [
+						{
+							"id": "hard",
+							"name": "Hard rule",
+							"shortDescription": {"text": "Hard rule"},
+							"helpUri": "https://example.com/hard"
+						},
+						{"id": "soft"}
+					]
+				}
+			},
+			"results": [
+				{
+					"ruleId": "hard",
+					"ruleIndex": 0,
+					"level": "error",
+					"message": {"text": "hard reason"},
+					"locations": [{
+						"physicalLocation": {
+							"artifactLocation": {"uri": "policy.rego"},
+							"region": {"startLine": 10, "startColumn": 1}
+						}
+					}]
+				},
+				{
+					"ruleId": "soft",
+					"ruleIndex": 1,
+					"level": "warning",
+					"message": {"text": "soft reason"},
+					"locations": [{
+						"physicalLocation": {
+							"artifactLocation": {"uri": "policy.rego"},
+							"region": {"startLine": 12, "startColumn": 1}
+						}
+					}]
+				}
+			]
+		}]
+	}`, buf.String())
+}
+
+func TestWriteDecisionSARIFSource(t *testing.T) {
+	decision := &Decision{
+		Status: StatusSoftFail,
+		SoftFailures: []Violation{{
+			Rule:   "no_prod",
+			Reason: "prod context is reserved",
+			Path:   []string{"workflows", "main", "jobs", "0", "deploy", "context"},
+			Source: &Location{File: ".circleci/config.yml", Row: 7, Col: 22},
+		}},
+	}
+	rules := []Rule{{Name: "no_prod", Location: &Location{File: "policy.rego", Row: 4, Col: 1}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDecisionSARIF(&buf, decision, rules))
+
+	require.JSONEq(t, `{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": [{
+			"tool": {
+				"driver": {
+					"name": "circle-policy-agent",
+					"informationUri": "https://github.com/CircleCI-Public/circle-policy-agent",
+					"rules": [{"id": "no_prod"}]
+				}
+			},
+			"results": [{
+				"ruleId": "no_prod",
+				"ruleIndex": 0,
+				"level": "warning",
+				"message": {"text": "prod context is reserved"},
+				"locations": [{
+					"physicalLocation": {
+						"artifactLocation": {"uri": ".circleci/config.yml"},
+						"region": {"startLine": 7, "startColumn": 22}
+					}
+				}]
+			}]
+		}]
+	}`, buf.String())
+}
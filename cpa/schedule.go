@@ -0,0 +1,82 @@
+package cpa
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// schedule is the declaration of when a rule is enforced, e.g.:
+//
+//	schedule["context_allowlist"] := {"hard_from": "2025-01-01"}
+//	schedule["freeze"] := {"from": "2024-12-20T00:00:00Z", "until": "2025-01-02T00:00:00Z"}
+//
+// The rule only applies from its from time, inclusive, until its until time, exclusive: its violations are
+// informational outside of that window. A soft rule becomes a hard failure from its hard_from time. Times are
+// RFC 3339 timestamps or dates in UTC.
+type schedule struct {
+	from     time.Time
+	until    time.Time
+	hardFrom time.Time
+}
+
+func (s schedule) active(now time.Time) bool {
+	return (s.from.IsZero() || !now.Before(s.from)) && (s.until.IsZero() || now.Before(s.until))
+}
+
+func (s schedule) hard(now time.Time) bool {
+	return !s.hardFrom.IsZero() && !now.Before(s.hardFrom)
+}
+
+func asSchedules(value interface{}) (map[string]schedule, error) {
+	if value == nil {
+		return nil, nil
+	}
+	declarations, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("value is not an object")
+	}
+
+	schedules := make(map[string]schedule, len(declarations))
+	for rule, declaration := range declarations {
+		fields, ok := declaration.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rule %q: declaration is not an object", rule)
+		}
+		var s schedule
+		for _, field := range []struct {
+			name string
+			time *time.Time
+		}{{"from", &s.from}, {"until", &s.until}, {"hard_from", &s.hardFrom}} {
+			value, ok := fields[field.name]
+			if !ok {
+				continue
+			}
+			t, err := asTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid %s: %w", rule, field.name, err)
+			}
+			*field.time = t
+		}
+		if !s.from.IsZero() && !s.until.IsZero() && !s.from.Before(s.until) {
+			return nil, fmt.Errorf("rule %q: from must be before until", rule)
+		}
+		schedules[rule] = s
+	}
+	return schedules, nil
+}
+
+func asTime(value interface{}) (time.Time, error) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.New("value is not a string")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a date", s)
+	}
+	return t, nil
+}
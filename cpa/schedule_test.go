@@ -0,0 +1,156 @@
+package cpa
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+enable_rule["freeze"]
+schedule["no_prod"] := {"hard_from": "2025-01-01"}
+schedule["freeze"] := {"from": "2024-12-20T00:00:00Z", "until": "2025-01-02T00:00:00Z"}
+no_prod = "prod context is reserved" { input.context == "prod" }
+freeze = sprintf("deploys are frozen until %s", [time.format([time.now_ns(), "UTC", "2006-01-02"])]) { input.deploy }
+`})
+	require.NoError(t, err)
+
+	enabled := []string{"freeze", "no_prod"}
+	noProd := Violation{Rule: "no_prod", Reason: "prod context is reserved"}
+	freeze := func(date string) Violation {
+		return Violation{Rule: "freeze", Reason: "deploys are frozen until " + date}
+	}
+
+	testCases := []struct {
+		Name     string
+		Now      string
+		Expected *Decision
+	}{
+		{
+			Name: "before window and hard date",
+			Now:  "2024-12-01T00:00:00Z",
+			Expected: &Decision{
+				Status:        StatusSoftFail,
+				EnabledRules:  enabled,
+				SoftFailures:  []Violation{noProd},
+				Informational: []Violation{freeze("2024-12-01")},
+			},
+		},
+		{
+			Name: "within window",
+			Now:  "2024-12-31T23:59:59Z",
+			Expected: &Decision{
+				Status:       StatusSoftFail,
+				EnabledRules: enabled,
+				SoftFailures: []Violation{freeze("2024-12-31"), noProd},
+			},
+		},
+		{
+			Name: "hard date reached",
+			Now:  "2025-01-01T00:00:00Z",
+			Expected: &Decision{
+				Status:       StatusHardFail,
+				EnabledRules: enabled,
+				HardFailures: []Violation{noProd},
+				SoftFailures: []Violation{freeze("2025-01-01")},
+			},
+		},
+		{
+			Name: "after window",
+			Now:  "2025-01-02T00:00:00Z",
+			Expected: &Decision{
+				Status:        StatusHardFail,
+				EnabledRules:  enabled,
+				HardFailures:  []Violation{noProd},
+				Informational: []Violation{freeze("2025-01-02")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tc.Now)
+			require.NoError(t, err)
+
+			decision, err := policy.Decide(
+				context.Background(),
+				map[string]any{"context": "prod", "deploy": true},
+				Clock(func() time.Time { return now }),
+			)
+			require.NoError(t, err)
+			require.Equal(t, tc.Expected, decision)
+		})
+	}
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+schedule["no_prod"] := {"hard_from": "next year"}
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+		require.NoError(t, err)
+
+		_, err = policy.Decide(context.Background(), map[string]any{})
+		require.EqualError(t, err, `invalid schedule: rule "no_prod": invalid hard_from: "next year" is neither an RFC 3339 timestamp nor a date`)
+	})
+}
+
+func TestScheduleClockDoesNotModifyOptions(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+	require.NoError(t, err)
+
+	// The clock option added by Decide must not be written to the spare capacity of the caller's options.
+	opts := make([]EvalOption, 1, 2)
+	opts[0] = RolloutBucket(0)
+	_, err = policy.Decide(context.Background(), map[string]any{"context": "prod"}, opts...)
+	require.NoError(t, err)
+	require.Nil(t, opts[:2][1])
+}
+
+func TestScheduleClockOncePerDecide(t *testing.T) {
+	policy, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+	require.NoError(t, err)
+
+	project, err := ParseBundle(map[string]string{"policy.rego": `package project
+policy_name["project"]
+`}, ProjectLayer())
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	clock := Clock(func() time.Time {
+		calls.Add(1)
+		return time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	})
+
+	t.Run("decide", func(t *testing.T) {
+		calls.Store(0)
+		shadowed := make(chan ShadowResult, 1)
+		_, err := policy.Decide(context.Background(), map[string]any{"context": "prod"}, clock, Project(project),
+			Shadow(policy, func(result ShadowResult) { shadowed <- result }))
+		require.NoError(t, err)
+		require.NoError(t, (<-shadowed).Err)
+		require.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("delta", func(t *testing.T) {
+		calls.Store(0)
+		_, err := policy.DecideDelta(context.Background(), map[string]any{}, map[string]any{"context": "prod"}, clock)
+		require.NoError(t, err)
+		require.Equal(t, int32(1), calls.Load())
+	})
+}
@@ -0,0 +1,50 @@
+package cpa
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// shadowTimeout bounds the evaluation of a shadow policy. The shadow policy runs once Decide has returned, so it is
+// not bounded by the context of the live decision, which the caller may cancel right away.
+const shadowTimeout = 10 * time.Second
+
+// ShadowResult compares the decision of a shadow policy with the live decision. Match reports whether both
+// decisions have the same status and violations. Shadow is nil when the shadow policy failed to decide, Err
+// holding the reason.
+type ShadowResult struct {
+	Live   *Decision
+	Shadow *Decision
+	Match  bool
+	Err    error
+}
+
+// decideShadow evaluates the shadow policy in the background and passes the result to report, so that the shadow
+// policy never delays the live decision.
+func (policy Policy) decideShadow(ctx context.Context, input interface{}, live *Decision, opts []EvalOption, report func(ShadowResult)) {
+	live = live.clone()
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, shadowTimeout)
+		defer cancel()
+		report(policy.compareShadow(ctx, input, live, opts))
+	}()
+}
+
+func (policy Policy) compareShadow(ctx context.Context, input interface{}, live *Decision, opts []EvalOption) ShadowResult {
+	result := ShadowResult{Live: live}
+
+	// The shadow policy must not evaluate itself again.
+	decision, err := policy.Decide(ctx, input, append(slices.Clip(opts), Shadow(nil, nil))...)
+	if err != nil {
+		result.Err = fmt.Errorf("shadow policy failed to decide: %w", err)
+		return result
+	}
+
+	result.Shadow = decision
+	result.Match = decisionsEqual(live, decision)
+	return result
+}
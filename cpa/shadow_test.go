@@ -0,0 +1,97 @@
+package cpa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShadow(t *testing.T) {
+	live, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule["no_prod"]
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+	require.NoError(t, err)
+
+	shadow, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_hard["no_prod"]
+no_prod = "prod context is reserved" { input.context == "prod" }
+`})
+	require.NoError(t, err)
+
+	// enable_rule must be a set, so the broken policy fails to decide.
+	broken, err := ParseBundle(map[string]string{"contexts.rego": `package org
+policy_name["contexts"]
+enable_rule := "no_prod"
+`})
+	require.NoError(t, err)
+
+	violation := Violation{Rule: "no_prod", Reason: "prod context is reserved"}
+	softFail := &Decision{Status: StatusSoftFail, EnabledRules: []string{"no_prod"}, SoftFailures: []Violation{violation}}
+
+	testCases := []struct {
+		Name     string
+		Input    any
+		Shadow   *Policy
+		Expected ShadowResult
+	}{
+		{
+			Name:   "decisions match",
+			Input:  map[string]any{"context": "staging"},
+			Shadow: shadow,
+			Expected: ShadowResult{
+				Live:   &Decision{Status: StatusPass, EnabledRules: []string{"no_prod"}},
+				Shadow: &Decision{Status: StatusPass, EnabledRules: []string{"no_prod"}},
+				Match:  true,
+			},
+		},
+		{
+			Name:   "decisions differ",
+			Input:  map[string]any{"context": "prod"},
+			Shadow: shadow,
+			Expected: ShadowResult{
+				Live: softFail,
+				Shadow: &Decision{
+					Status:       StatusHardFail,
+					EnabledRules: []string{"no_prod"},
+					HardFailures: []Violation{violation},
+				},
+			},
+		},
+		{
+			Name:   "shadow error does not fail live decision",
+			Input:  map[string]any{"context": "prod"},
+			Shadow: broken,
+			Expected: ShadowResult{
+				Live: softFail,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			results := make(chan ShadowResult, 1)
+			ctx, cancel := context.WithCancel(context.Background())
+			decision, err := live.Decide(ctx, tc.Input, Shadow(tc.Shadow, func(result ShadowResult) {
+				results <- result
+			}))
+			// Canceling the context of the live decision does not cancel the shadow evaluation.
+			cancel()
+			require.NoError(t, err)
+			require.Equal(t, tc.Expected.Live, decision)
+
+			result := <-results
+			if tc.Expected.Shadow == nil {
+				require.Equal(t, tc.Expected.Live, result.Live)
+				require.Nil(t, result.Shadow)
+				require.ErrorContains(t, result.Err, "invalid enable_rule")
+				require.False(t, result.Match)
+				return
+			}
+			require.Equal(t, tc.Expected, result)
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package cpa
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scopes of the violations a suppression applies to.
+const (
+	ScopeFile     = "file"
+	ScopeJob      = "job"
+	ScopeWorkflow = "workflow"
+)
+
+// Suppression acknowledges violations of rules in a config with a comment, e.g.:
+//
+//	jobs:
+//	  deploy: # policy-ignore: context_allowlist reason="deploys are reviewed by the release team"
+//	    context: prod
+//
+// A comment within a job or a workflow suppresses the violations located in it by their path, any other comment
+// suppresses the violations of the whole file. Several rules can be listed, separated by commas.
+type Suppression struct {
+	Rules  []string `json:"rules"`
+	Reason string   `json:"reason,omitempty"`
+	Scope  string   `json:"scope"`
+	// Name is the name of the job or workflow of the suppression.
+	Name string `json:"name,omitempty"`
+	// Line is the line of the comment in the config.
+	Line int `json:"line"`
+}
+
+var suppressionExpr = regexp.MustCompile(`^#\s*policy-ignore:\s*([\w,\s-]+?)(?:\s+reason="([^"]*)")?\s*$`)
+
+// suppressionCommentExpr locates a suppression comment in a line of config.
+var suppressionCommentExpr = regexp.MustCompile(`#\s*policy-ignore:.*$`)
+
+// ParseSuppressions collects the suppression comments of a CircleCI config.
+func ParseSuppressions(config []byte) ([]Suppression, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(config, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return suppressions(&document, config), nil
+}
+
+func suppressions(document *yaml.Node, config []byte) []Suppression {
+	var result []Suppression
+
+	// Nodes only hold the line of their value, and a head comment may be separated from its node by blank lines,
+	// so comments are located in the config: at the nearest line holding the same comment not located yet.
+	lines := make(map[string][]int)
+	for i, line := range strings.Split(string(config), "\n") {
+		if comment := suppressionCommentExpr.FindString(line); comment != "" {
+			lines[strings.TrimSpace(comment)] = append(lines[strings.TrimSpace(comment)], i+1)
+		}
+	}
+	commentLine := func(comment string, near int) int {
+		candidates := lines[comment]
+		if len(candidates) == 0 {
+			return near
+		}
+		nearest := 0
+		for i, line := range candidates {
+			if abs(line-near) < abs(candidates[nearest]-near) {
+				nearest = i
+			}
+		}
+		line := candidates[nearest]
+		lines[comment] = slices.Delete(candidates, nearest, nearest+1)
+		return line
+	}
+
+	comments := func(node *yaml.Node, scope, name string) {
+		for _, comment := range []string{node.HeadComment, node.LineComment, node.FootComment} {
+			for _, line := range strings.Split(comment, "\n") {
+				line = strings.TrimSpace(line)
+				match := suppressionExpr.FindStringSubmatch(line)
+				if match == nil {
+					continue
+				}
+				result = append(result, Suppression{
+					Rules: strings.FieldsFunc(match[1], func(r rune) bool {
+						return r == ',' || r == ' ' || r == '\t'
+					}),
+					Reason: match[2],
+					Scope:  scope,
+					Name:   name,
+					Line:   commentLine(line, node.Line),
+				})
+			}
+		}
+	}
+
+	var walk func(node *yaml.Node, scope, name string)
+	walk = func(node *yaml.Node, scope, name string) {
+		comments(node, scope, name)
+		for _, child := range node.Content {
+			walk(child, scope, name)
+		}
+	}
+
+	comments(document, ScopeFile, "")
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		for _, child := range document.Content {
+			walk(child, ScopeFile, "")
+		}
+		return result
+	}
+
+	root := document.Content[0]
+	comments(root, ScopeFile, "")
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+
+		var scope string
+		switch key.Value {
+		case "jobs":
+			scope = ScopeJob
+		case "workflows":
+			scope = ScopeWorkflow
+		}
+		if scope == "" || value.Kind != yaml.MappingNode {
+			walk(key, ScopeFile, "")
+			walk(value, ScopeFile, "")
+			continue
+		}
+
+		comments(key, ScopeFile, "")
+		comments(value, ScopeFile, "")
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			name := value.Content[j].Value
+			walk(value.Content[j], scope, name)
+			walk(value.Content[j+1], scope, name)
+		}
+	}
+
+	return result
+}
+
+// suppresses reports whether the suppression applies to the violation.
+func (s Suppression) suppresses(violation Violation) bool {
+	matches := false
+	for _, rule := range s.Rules {
+		if rule == violation.Rule {
+			matches = true
+		}
+	}
+	if !matches {
+		return false
+	}
+	switch s.Scope {
+	case ScopeFile:
+		return true
+	case ScopeJob:
+		return len(violation.Path) >= 2 && violation.Path[0] == "jobs" && violation.Path[1] == s.Name
+	case ScopeWorkflow:
+		return len(violation.Path) >= 2 && violation.Path[0] == "workflows" && violation.Path[1] == s.Name
+	default:
+		return false
+	}
+}
+
+// equal reports whether two suppressions are the same comment.
+func (s Suppression) equal(other Suppression) bool {
+	return s.Reason == other.Reason && s.Scope == other.Scope && s.Name == other.Name && s.Line == other.Line &&
+		slices.Equal(s.Rules, other.Rules)
+}
+
+// suppress moves the hard and soft failures suppressed by the suppressions to the suppressed violations of the
+// decision, unless their rule is non-suppressible. The job and workflow suppressions that suppressed no violation
+// are reported as unmatched: they only apply to violations with a path, which helper rules do not return.
+func (d *Decision) suppress(suppressions []Suppression, nonSuppressible map[string]struct{}) {
+	matched := make([]bool, len(suppressions))
+	split := func(violations []Violation) []Violation {
+		var remaining []Violation
+		for _, violation := range violations {
+			if _, ok := nonSuppressible[violation.Rule]; !ok {
+				if i := suppressionOf(suppressions, violation, matched); i >= 0 {
+					violation.SuppressionReason = suppressions[i].Reason
+					d.Suppressed = append(d.Suppressed, violation)
+					continue
+				}
+			}
+			remaining = append(remaining, violation)
+		}
+		return remaining
+	}
+	d.HardFailures = split(d.HardFailures)
+	d.SoftFailures = split(d.SoftFailures)
+
+	for i, suppression := range suppressions {
+		if !matched[i] && suppression.Scope != ScopeFile {
+			d.UnmatchedSuppressions = append(d.UnmatchedSuppressions, suppression)
+		}
+	}
+}
+
+// suppressionOf returns the index of the first suppression of the violation, or -1, and marks every suppression
+// of the violation as matched.
+func suppressionOf(suppressions []Suppression, violation Violation, matched []bool) int {
+	first := -1
+	for i, suppression := range suppressions {
+		if suppression.suppresses(violation) {
+			matched[i] = true
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	return first
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,174 @@
+package cpa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppressions(t *testing.T) {
+	config := []byte(`# policy-ignore: no_orbs reason="orbs are reviewed"
+version: 2.1
+orbs:
+  node: circleci/node@5
+jobs:
+  build: # policy-ignore: pinned_images, no_prod reason="legacy image"
+    docker:
+      - image: cimg/base:latest
+  test:
+    docker:
+      - image: cimg/node:latest
+workflows:
+  main:
+    jobs:
+      # policy-ignore: no_prod
+      - deploy:
+          context: prod
+`)
+
+	suppressions, err := ParseSuppressions(config)
+	require.NoError(t, err)
+	require.Equal(t, []Suppression{
+		{Rules: []string{"no_orbs"}, Reason: "orbs are reviewed", Scope: ScopeFile, Line: 1},
+		{Rules: []string{"pinned_images", "no_prod"}, Reason: "legacy image", Scope: ScopeJob, Name: "build", Line: 6},
+		{Rules: []string{"no_prod"}, Scope: ScopeWorkflow, Name: "main", Line: 15},
+	}, suppressions)
+
+	bundle := map[string]string{"policy.rego": `package org
+policy_name["config"]
+enable_hard["no_prod"]
+enable_rule["pinned_images"]
+enable_rule["no_orbs"]
+no_prod[{"reason": sprintf("%s: uses context prod", [name]), "path": ["workflows", wf, "jobs", i, name, "context"]}] {
+	job := input.workflows[wf].jobs[i][name]
+	job.context == "prod"
+}
+pinned_images[{"reason": sprintf("%s: image is not pinned", [name]), "path": ["jobs", name, "docker", "0", "image"]}] {
+	endswith(input.jobs[name].docker[0].image, ":latest")
+}
+no_orbs = "orbs are not allowed" { input.orbs }
+`}
+
+	policy, err := ParseBundle(bundle)
+	require.NoError(t, err)
+
+	decision, err := policy.DecideYAML(context.Background(), config)
+	require.NoError(t, err)
+	require.Equal(t, &Decision{
+		Status:       StatusSoftFail,
+		EnabledRules: []string{"no_orbs", "no_prod", "pinned_images"},
+		SoftFailures: []Violation{{
+			Rule:   "pinned_images",
+			Reason: "test: image is not pinned",
+			Path:   []string{"jobs", "test", "docker", "0", "image"},
+			Source: &Location{File: ".circleci/config.yml", Row: 11, Col: 9},
+		}},
+		Suppressed: []Violation{
+			{
+				Rule:              "no_orbs",
+				Reason:            "orbs are not allowed",
+				SuppressionReason: "orbs are reviewed",
+			},
+			{
+				Rule:   "no_prod",
+				Reason: "deploy: uses context prod",
+				Path:   []string{"workflows", "main", "jobs", "0", "deploy", "context"},
+				Source: &Location{File: ".circleci/config.yml", Row: 17, Col: 11},
+			},
+			{
+				Rule:              "pinned_images",
+				Reason:            "build: image is not pinned",
+				Path:              []string{"jobs", "build", "docker", "0", "image"},
+				Source:            &Location{File: ".circleci/config.yml", Row: 8, Col: 9},
+				SuppressionReason: "legacy image",
+			},
+		},
+	}, decision)
+
+	bundle["policy.rego"] += "non_suppressible[\"no_prod\"]\n"
+	policy, err = ParseBundle(bundle)
+	require.NoError(t, err)
+
+	decision, err = policy.DecideYAML(context.Background(), config)
+	require.NoError(t, err)
+	require.Equal(t, StatusHardFail, decision.Status)
+	require.Equal(t, "no_prod", decision.HardFailures[0].Rule)
+	require.Len(t, decision.Suppressed, 2)
+}
+
+func TestSuppressionLines(t *testing.T) {
+	config := []byte(`# policy-ignore: no_orbs
+
+version: 2.1
+jobs:
+  build: # policy-ignore: no_prod
+    context: prod
+  test: # policy-ignore: no_prod
+    context: prod
+`)
+
+	suppressions, err := ParseSuppressions(config)
+	require.NoError(t, err)
+	require.Equal(t, []Suppression{
+		{Rules: []string{"no_orbs"}, Scope: ScopeFile, Line: 1},
+		{Rules: []string{"no_prod"}, Scope: ScopeJob, Name: "build", Line: 5},
+		{Rules: []string{"no_prod"}, Scope: ScopeJob, Name: "test", Line: 7},
+	}, suppressions)
+}
+
+func TestNonSuppressible(t *testing.T) {
+	rego := `package org
+policy_name["config"]
+enable_rule["no_prod"]
+no_prod = "prod context is reserved" { input.context == "prod" }
+`
+
+	// non_suppressible is validated even when no suppression is given.
+	policy, err := ParseBundle(map[string]string{"policy.rego": rego + "non_suppressible := \"no_prod\"\n"})
+	require.NoError(t, err)
+	_, err = policy.Decide(context.Background(), map[string]any{"context": "prod"})
+	require.EqualError(t, err, "invalid non_suppressible: value is not a slice")
+
+	_, err = ParseBundle(map[string]string{"policy.rego": rego + "non_suppressible[\"no_prd\"]\n"})
+	require.ErrorContains(t, err, `non_suppressible references rule "no_prd" which is not defined in package org`)
+}
+
+func TestUnmatchedSuppressions(t *testing.T) {
+	config := []byte(`jobs:
+  build: # policy-ignore: pinned_images
+    docker:
+      - image: cimg/base:latest
+  deploy: # policy-ignore: no_prod
+    context: prod
+`)
+
+	policy, err := ParseBundle(map[string]string{"policy.rego": `package org
+policy_name["config"]
+enable_rule["no_prod"]
+enable_rule["pinned_images"]
+no_prod = "prod context is reserved" { input.jobs[_].context == "prod" }
+pinned_images[{"reason": sprintf("%s: image is not pinned", [name]), "path": ["jobs", name, "docker", "0", "image"]}] {
+	endswith(input.jobs[name].docker[0].image, ":latest")
+}
+`})
+	require.NoError(t, err)
+
+	project, err := ParseBundle(map[string]string{"policy.rego": `package project
+policy_name["project"]
+`}, ProjectLayer())
+	require.NoError(t, err)
+
+	// The violation of no_prod has no path, so the job suppression cannot apply to it.
+	unmatched := []Suppression{{Rules: []string{"no_prod"}, Scope: ScopeJob, Name: "deploy", Line: 5}}
+
+	decision, err := policy.DecideYAML(context.Background(), config)
+	require.NoError(t, err)
+	require.Equal(t, StatusSoftFail, decision.Status)
+	require.Len(t, decision.Suppressed, 1)
+	require.Equal(t, unmatched, decision.UnmatchedSuppressions)
+
+	decision, err = policy.DecideYAML(context.Background(), config, Project(project))
+	require.NoError(t, err)
+	require.Equal(t, unmatched, decision.UnmatchedSuppressions)
+}
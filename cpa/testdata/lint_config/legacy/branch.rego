@@ -0,0 +1,11 @@
+package org
+
+policy_name["legacy_branch"]
+
+enable_rule["main_branch"]
+
+main_branch = "must run on main" {
+	data.meta.branch != "main"
+}
+
+leftover = "never enabled"
@@ -0,0 +1,9 @@
+package org
+
+policy_name["legacy_branch"]
+
+enable_rule["main_branch"]
+
+main_branch = "branch must not be main" {
+	data.meta.branch == "main"
+}
@@ -0,0 +1,22 @@
+package org
+
+import future.keywords.in
+
+policy_name["migration_contexts"]
+
+enable_rule["reserved_contexts"]
+
+hard_fail["reserved_contexts"]
+
+enable_rule["job_names"]
+
+reserved_contexts[reason] {
+	some name, job in input.jobs
+	job.context == "prod"
+	reason := sprintf("job %s uses reserved context prod", [name])
+}
+
+job_names = "job names must be lower case" {
+	some name, _ in input.jobs
+	lower(name) != name
+}
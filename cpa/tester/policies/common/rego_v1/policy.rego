@@ -0,0 +1,11 @@
+package org
+
+policy_name contains "rego_v1"
+
+enable_rule contains "name_is_alice"
+
+hard_fail contains "name_is_alice" if data.meta.hard
+
+name_is_alice := "name must be alice!" if {
+	input.name != "alice"
+}
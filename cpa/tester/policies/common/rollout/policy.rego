@@ -0,0 +1,11 @@
+package org
+
+import future.keywords
+
+policy_name["rollout"]
+
+enable_hard["name_is_alice"]
+
+rollout["name_is_alice"] := {"percentage": 10, "salt": "alice"}
+
+name_is_alice := "name must be alice!" if input.name != "alice"
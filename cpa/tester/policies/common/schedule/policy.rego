@@ -0,0 +1,11 @@
+package org
+
+import future.keywords
+
+policy_name["schedule"]
+
+enable_rule["name_is_alice"]
+
+schedule["name_is_alice"] := {"hard_from": "2025-01-01"}
+
+name_is_alice := "name must be alice!" if input.name != "alice"
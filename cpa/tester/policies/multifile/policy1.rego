@@ -3,3 +3,5 @@ package org
 policy_name["multifile_policy1"]
 
 enable_rule["multifile_policy1"]
+
+multifile_policy1 = "name must be bob" { input.name != "bob" }
@@ -3,3 +3,5 @@ package org
 policy_name["multifile_policy2"]
 
 enable_rule["multifile_policy2"]
+
+multifile_policy2 = "name must be bob" { input.name != "bob" }
@@ -3,3 +3,5 @@ package org
 policy_name["multifile_policy3"]
 
 enable_rule["multifile_policy3"]
+
+multifile_policy3 = "name must be bob" { input.name != "bob" }
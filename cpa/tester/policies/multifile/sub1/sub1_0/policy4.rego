@@ -3,3 +3,5 @@ package org
 policy_name["multifile_policy4"]
 
 enable_rule["multifile_policy4"]
+
+multifile_policy4 = "name must be bob" { input.name != "bob" }
@@ -13,6 +13,7 @@ import (
 	"github.com/CircleCI-Public/circle-policy-agent/cpa"
 	"github.com/CircleCI-Public/circle-policy-agent/internal"
 	"github.com/CircleCI-Public/circle-policy-agent/internal/junit"
+	"github.com/CircleCI-Public/circle-policy-agent/internal/sarif"
 
 	"gopkg.in/yaml.v3"
 )
@@ -257,6 +258,69 @@ func (rh JUnitResultHandler) HandleResults(c <-chan Result) bool {
 	return root.Failures+root.Errors == 0
 }
 
+const (
+	sarifTestFailureRule = "test-failure"
+	sarifTestErrorRule   = "test-error"
+)
+
+type SARIFResultHandler struct {
+	w io.Writer
+}
+
+// HandleResults writes failed tests and groups that failed to load as SARIF 2.1.0 results located at their
+// test folder. Native rego test failures have no location.
+func (rh SARIFResultHandler) HandleResults(c <-chan Result) bool {
+	log := sarif.NewLog(sarif.Driver{
+		Name:           "circle-policy-agent",
+		InformationURI: "https://github.com/CircleCI-Public/circle-policy-agent",
+		Rules: []sarif.ReportingDescriptor{
+			{
+				ID:                   sarifTestFailureRule,
+				ShortDescription:     &sarif.Message{Text: "Policy test decision does not match the expected decision"},
+				DefaultConfiguration: &sarif.ReportingConfiguration{Level: sarif.LevelError},
+			},
+			{
+				ID:                   sarifTestErrorRule,
+				ShortDescription:     &sarif.Message{Text: "Policy tests could not be loaded"},
+				DefaultConfiguration: &sarif.ReportingConfiguration{Level: sarif.LevelError},
+			},
+		},
+	})
+
+	ok := true
+
+	for result := range c {
+		if result.Passed {
+			continue
+		}
+		ok = false
+
+		rule, message := sarifTestFailureRule, result.Name
+		if result.Name == "" {
+			rule, message = sarifTestErrorRule, result.Group
+		}
+		if result.Err != nil {
+			message += ": " + result.Err.Error()
+		}
+
+		sarifResult := sarif.Result{RuleID: rule, Level: sarif.LevelError, Message: sarif.Message{Text: message}}
+		if result.Group != opaTestsGroup {
+			sarifResult.Locations = []sarif.Location{sarif.NewLocation(result.Group, 0, 0)}
+		}
+		log.AddResult(sarifResult)
+	}
+
+	_ = log.Encode(rh.w)
+	return ok
+}
+
+func MakeSARIFResultHandler(opts ResultHandlerOptions) SARIFResultHandler {
+	if opts.Dst == nil {
+		opts.Dst = os.Stderr
+	}
+	return SARIFResultHandler{opts.Dst}
+}
+
 func MakeJUnitResultHandler(opts ResultHandlerOptions) JUnitResultHandler {
 	return MakeJUnitResultHandlerWithGetTime(opts, time.Now)
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -20,19 +21,27 @@ import (
 )
 
 type Runner struct {
-	include *regexp.Regexp
-	folders []string
-	compile func([]byte, map[string]any) ([]byte, error)
+	include           *regexp.Regexp
+	folders           []string
+	compile           func([]byte, map[string]any) ([]byte, error)
+	validateMigration bool
+	parseOptions      []cpa.ParseOption
 }
 
 type RunnerOptions struct {
 	Path    string
 	Include *regexp.Regexp
 	Compile func([]byte, map[string]any) ([]byte, error)
+	// ValidateMigration also evaluates every test against the policies migrated to rego v1 with cpa.Migrate,
+	// and fails the tests whose decision changes.
+	ValidateMigration bool
 }
 
 var ErrNoTests = errors.New("no tests")
 
+// opaTestsGroup is the result group of native rego tests, which are not tied to a single test folder.
+const opaTestsGroup = "<opa.tests>"
+
 func NewRunner(opts RunnerOptions) (*Runner, error) {
 	if opts.Path == "" {
 		opts.Path = "./..."
@@ -43,13 +52,40 @@ func NewRunner(opts RunnerOptions) (*Runner, error) {
 		return nil, fmt.Errorf("failed to lookup test folders: %w", err)
 	}
 
+	var parseOptions []cpa.ParseOption
+	if len(folders) > 0 {
+		parseOptions, err = lintConfigOptions(folders[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Runner{
-		include: opts.Include,
-		folders: folders,
-		compile: opts.Compile,
+		include:           opts.Include,
+		folders:           folders,
+		compile:           opts.Compile,
+		validateMigration: opts.ValidateMigration,
+		parseOptions:      parseOptions,
 	}, nil
 }
 
+// lintConfigOptions loads the lint configuration file of the root test folder, if any. It applies to every test
+// folder below the root, since cpa.LoadPolicyFromFS only looks for one in the folder it loads.
+func lintConfigOptions(root string) ([]cpa.ParseOption, error) {
+	file := filepath.Join(root, cpa.LintConfigFile)
+	if _, err := os.Stat(file); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find lint config: %w", err)
+	}
+	config, err := cpa.LoadLintConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	return []cpa.ParseOption{cpa.WithLintConfig(config)}, nil
+}
+
 func (runner *Runner) Run() <-chan Result {
 	results := make(chan Result)
 
@@ -71,13 +107,13 @@ func (runner *Runner) RunAndHandleResults(handler ResultHandler) bool {
 func (runner *Runner) runOpaTests(results chan<- Result) {
 	root := runner.folders[0]
 
-	policy, err := cpa.LoadPolicyFromFS(root)
+	policy, err := cpa.LoadPolicyFromFS(root, runner.parseOptions...)
 	if err != nil {
 		if errors.Is(err, cpa.ErrNoPolicies) {
 			return
 		}
 		results <- Result{
-			Group: "<opa.tests>",
+			Group: opaTestsGroup,
 			Err:   err,
 		}
 		return
@@ -89,7 +125,7 @@ func (runner *Runner) runOpaTests(results chan<- Result) {
 			continue
 		}
 		results <- Result{
-			Group:   "<opa.tests>",
+			Group:   opaTestsGroup,
 			Name:    name,
 			Passed:  r.Pass(),
 			Elapsed: r.Duration,
@@ -99,7 +135,7 @@ func (runner *Runner) runOpaTests(results chan<- Result) {
 }
 
 func (runner *Runner) runFolder(folder string, results chan<- Result) {
-	policy, err := cpa.LoadPolicyFromFS(folder)
+	policy, err := cpa.LoadPolicyFromFS(folder, runner.parseOptions...)
 	if err != nil {
 		results <- Result{
 			Group:  folder,
@@ -109,6 +145,18 @@ func (runner *Runner) runFolder(folder string, results chan<- Result) {
 		return
 	}
 
+	var migrated *cpa.Policy
+	if runner.validateMigration {
+		migrated, err = cpa.LoadPolicyFromFS(folder, append([]cpa.ParseOption{cpa.MigrateToV1()}, runner.parseOptions...)...)
+		if err != nil {
+			results <- Result{
+				Group: folder,
+				Err:   fmt.Errorf("failed to migrate policy: %w", err),
+			}
+			return
+		}
+	}
+
 	nameSet := map[string]struct{}{}
 	var namedTests []NamedTest
 
@@ -167,11 +215,17 @@ func (runner *Runner) runFolder(folder string, results chan<- Result) {
 	})
 
 	for _, t := range namedTests {
-		runner.runTest(policy, results, t, folder, ParentTestContext{})
+		runner.runTest(policy, migrated, results, t, folder, ParentTestContext{})
 	}
 }
 
-func (runner *Runner) runTest(policy *cpa.Policy, results chan<- Result, t NamedTest, group string, parent ParentTestContext) {
+func (runner *Runner) runTest(
+	policy, migrated *cpa.Policy,
+	results chan<- Result,
+	t NamedTest,
+	group string,
+	parent ParentTestContext,
+) {
 	compile := func() bool {
 		if t.Compile != nil {
 			return *t.Compile
@@ -200,6 +254,16 @@ func (runner *Runner) runTest(policy *cpa.Policy, results chan<- Result, t Named
 		return internal.Merge(parent.Meta, t.Meta)
 	}()
 
+	rolloutBucket := t.RolloutBucket
+	if rolloutBucket == nil {
+		rolloutBucket = parent.RolloutBucket
+	}
+
+	now := t.Now
+	if now == "" {
+		now = parent.Now
+	}
+
 	decision := func() any {
 		if t.Decision == nil {
 			return parent.Decision
@@ -249,13 +313,54 @@ func (runner *Runner) runTest(policy *cpa.Policy, results chan<- Result, t Named
 				}()
 			}
 
-			eval, _ := policy.Eval(context.Background(), "data", input, cpa.Meta(meta))
+			decideOptions := []cpa.EvalOption{cpa.Meta(meta)}
+			if rolloutBucket != nil {
+				decideOptions = append(decideOptions, cpa.RolloutBucket(*rolloutBucket))
+			}
+			if now != "" {
+				pinned, err := time.Parse(time.RFC3339, now)
+				if err != nil {
+					results <- Result{
+						Group: group,
+						Name:  name,
+						Err:   fmt.Errorf("invalid now: %w", err),
+					}
+					return
+				}
+				decideOptions = append(decideOptions, cpa.Clock(func() time.Time { return pinned }))
+			}
+
+			eval, _ := policy.Eval(context.Background(), "data", input, decideOptions...)
 
 			start := time.Now()
-			var actualDecision any = internal.Must2(policy.Decide(context.Background(), input, cpa.Meta(meta)))
+			var actualDecision any = internal.Must2(policy.Decide(context.Background(), input, decideOptions...))
 			elapsed := time.Since(start)
 
-			actualDecision = internal.Must2(internal.ToRawInterface(actualDecision))
+			if migrated != nil {
+				migratedDecision := internal.Must2(migrated.Decide(context.Background(), input, decideOptions...))
+				diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+					A:        difflib.SplitLines(internal.Must2(yamlfy(withoutErrorLocation(actualDecision.(*cpa.Decision))))),
+					FromFile: "Original",
+					B:        difflib.SplitLines(internal.Must2(yamlfy(withoutErrorLocation(migratedDecision)))),
+					ToFile:   "Migrated",
+					Context:  1,
+				})
+				if diff != "" {
+					results <- Result{
+						Group: group,
+						Name:  name,
+						Err:   fmt.Errorf("decision changed by migration to rego v1:\n%s", diff),
+						Ctx: map[string]any{
+							"input":    input,
+							"decision": actualDecision,
+							"migrated": migratedDecision,
+						},
+					}
+					return
+				}
+			}
+
+			actualDecision = matchErrorAssertion(decision, internal.Must2(internal.ToRawInterface(actualDecision)))
 
 			diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
 				A:        difflib.SplitLines(internal.Must2(yamlfy(decision))),
@@ -292,13 +397,62 @@ func (runner *Runner) runTest(policy *cpa.Policy, results chan<- Result, t Named
 		Decision:           decision,
 		Compile:            compile,
 		PipelineParameters: pipelineParams,
+		RolloutBucket:      rolloutBucket,
+		Now:                now,
 	}
 
 	for _, subtest := range t.NamedCases() {
-		runner.runTest(policy, results, subtest, group, parentContext)
+		runner.runTest(policy, migrated, results, subtest, group, parentContext)
 	}
 }
 
+// withoutErrorLocation returns a copy of an error decision without the parts that refer to a source location,
+// which migration moves around. Other decisions are returned as is.
+func withoutErrorLocation(decision *cpa.Decision) *cpa.Decision {
+	if decision.Error == nil {
+		return decision
+	}
+	result := *decision
+	evalErr := *decision.Error
+	evalErr.Location, evalErr.Message = nil, ""
+	result.Error, result.Reason = &evalErr, ""
+	return &result
+}
+
+// matchErrorAssertion trims the actual decision's error down to what the expected decision asserts on.
+// This lets tests assert on an error code without spelling out the full message and location. The reason
+// is only compared when asserted on, and the error is ignored entirely when the expected decision omits it.
+func matchErrorAssertion(expected, actual any) any {
+	expectedDecision, ok := expected.(map[string]any)
+	if !ok {
+		return actual
+	}
+	actualDecision, ok := actual.(map[string]any)
+	if !ok {
+		return actual
+	}
+
+	expectedErr, ok := expectedDecision["error"].(map[string]any)
+	if !ok {
+		delete(actualDecision, "error")
+		return actualDecision
+	}
+
+	if _, ok := expectedDecision["reason"]; !ok {
+		delete(actualDecision, "reason")
+	}
+
+	if actualErr, ok := actualDecision["error"].(map[string]any); ok {
+		for key := range actualErr {
+			if _, ok := expectedErr[key]; !ok {
+				delete(actualErr, key)
+			}
+		}
+	}
+
+	return actualDecision
+}
+
 func yamlfy(value any) (string, error) {
 	raw, err := yaml.Marshal(value)
 	return string(raw), err
@@ -2,6 +2,7 @@ package tester
 
 import (
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"os"
 	"regexp"
@@ -46,6 +47,9 @@ func TestRunner(t *testing.T) {
 		"policies/common/error",
 		"policies/common/no_enabled_rules",
 		"policies/common/reason_types",
+		"policies/common/rego_v1",
+		"policies/common/rollout",
+		"policies/common/schedule",
 		"policies/common/soft_and_hard_fail_together",
 		"policies/common/structure",
 		"policies/helpers",
@@ -191,6 +195,34 @@ func TestFailedPolicies(t *testing.T) {
 	)
 }
 
+func TestFailedPoliciesSARIF(t *testing.T) {
+	runner, err := NewRunner(RunnerOptions{Path: "./failed_policies/..."})
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	ok := MakeSARIFResultHandler(ResultHandlerOptions{Dst: buf}).HandleResults(runner.Run())
+	require.False(t, ok)
+
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []any  `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+
+	require.Len(t, log.Runs, 1)
+	require.Len(t, log.Runs[0].Results, 1)
+
+	result := log.Runs[0].Results[0]
+	require.Equal(t, "test-failure", result.RuleID)
+	require.Equal(t, "error", result.Level)
+	require.Empty(t, result.Locations)
+}
+
 func TestCompilePolicies(t *testing.T) {
 	t.Run("with compiler", func(t *testing.T) {
 		options := RunnerOptions{
@@ -304,3 +336,32 @@ func TestPipelineParameters(t *testing.T) {
 		Dst:     os.Stdout,
 	})))
 }
+
+func TestRunnerValidateMigration(t *testing.T) {
+	runner, err := NewRunner(RunnerOptions{Path: "./migration_policies/...", ValidateMigration: true})
+	require.NoError(t, err)
+
+	var names []string
+	for result := range runner.Run() {
+		require.True(t, result.Passed, "%s %s: %v", result.Group, result.Name, result.Err)
+		if result.Name != "" {
+			names = append(names, result.Name)
+		}
+	}
+	require.Equal(t, []string{"test_pass", "test_reserved_contexts"}, names)
+}
+
+func TestRunnerLintConfig(t *testing.T) {
+	runner, err := NewRunner(RunnerOptions{Path: "./lint_config_policies/..."})
+	require.NoError(t, err)
+
+	var results []Result
+	for result := range runner.Run() {
+		results = append(results, result)
+	}
+
+	require.Len(t, results, 2)
+	require.Equal(t, "lint_config_policies/legacy", results[1].Group)
+	require.Equal(t, "test_legacy_branch", results[1].Name)
+	require.True(t, results[1].Passed, results[1].Err)
+}
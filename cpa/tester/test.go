@@ -18,6 +18,8 @@ type Test struct {
 	Decision           any
 	Compile            *bool
 	PipelineParameters map[string]any `yaml:"pipeline_parameters"`
+	RolloutBucket      *int           `yaml:"rollout_bucket"`
+	Now                string
 	Cases              map[string]*Test
 }
 
@@ -45,6 +47,8 @@ type ParentTestContext struct {
 	Decision           any
 	Compile            bool
 	PipelineParameters map[string]any
+	RolloutBucket      *int
+	Now                string
 }
 
 func loadTests(path string) (tests map[string]*Test, err error) {
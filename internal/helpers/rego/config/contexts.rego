@@ -1,10 +1,10 @@
 package circleci.config
 
-import data.circleci.utils
+import rego.v1
 
-import future.keywords
+import data.circleci.utils
 
-contexts_blocked_by_project_ids(project_id, context_list) = {reason |
+contexts_blocked_by_project_ids(project_id, context_list) := {reason |
 	utils.to_set(project_id)[data.meta.project_id]
 
 	some wf_name, workflow in input._compiled_.workflows
@@ -16,7 +16,7 @@ contexts_blocked_by_project_ids(project_id, context_list) = {reason |
 	reason := sprintf("%s.%s: uses context value(s) in blocklist for project: %s", [wf_name, job_name, concat(", ", illegal_contexts)])
 }
 
-contexts_allowed_by_project_ids(project_id, context_list) = {reason |
+contexts_allowed_by_project_ids(project_id, context_list) := {reason |
 	utils.to_set(project_id)[data.meta.project_id]
 
 	some wf_name, workflow in input._compiled_.workflows
@@ -28,7 +28,7 @@ contexts_allowed_by_project_ids(project_id, context_list) = {reason |
 	reason := sprintf("%s.%s: uses context value(s) not in allowlist for project: %s", [wf_name, job_name, concat(", ", illegal_contexts)])
 }
 
-contexts_reserved_by_project_ids(project_id, context_list) = {reason |
+contexts_reserved_by_project_ids(project_id, context_list) := {reason |
 	not utils.to_set(project_id)[data.meta.project_id]
 
 	some wf_name, workflow in input._compiled_.workflows
@@ -40,7 +40,7 @@ contexts_reserved_by_project_ids(project_id, context_list) = {reason |
 	reason := sprintf("%s.%s: uses context value(s) reserved to other projects: %s", [wf_name, job_name, concat(", ", illegal_contexts)])
 }
 
-contexts_reserved_by_branches(branch_list, context_list) = {reason |
+contexts_reserved_by_branches(branch_list, context_list) := {reason |
 	some wf_name, workflow in input.workflows
 	some job_name, job_info in workflow.jobs[_]
 
@@ -1,10 +1,10 @@
 package circleci.config
 
-import future.keywords
+import rego.v1
 
-resource_class_by_project(reservered_classes_to_projects) = {reason | 
-        some job_name, job_info in input._compiled_.jobs
-        allowed_projects := reservered_classes_to_projects[job_info.resource_class]
-        not data.meta.project_id in allowed_projects
-        reason := sprintf("project is not allowed to use resource_class %q declared in job %q", [job_info.resource_class, job_name])
+resource_class_by_project(reservered_classes_to_projects) := {reason |
+	some job_name, job_info in input._compiled_.jobs
+	allowed_projects := reservered_classes_to_projects[job_info.resource_class]
+	not data.meta.project_id in allowed_projects
+	reason := sprintf("project is not allowed to use resource_class %q declared in job %q", [job_info.resource_class, job_name])
 }
@@ -1,20 +1,24 @@
 package circleci.utils
 
-import future.keywords
+import rego.v1
 
-# Convert value to set if it isn't one 
+# Convert value to set if it isn't one
 to_set(value) := value if {
 	is_set(value)
-} else := {elem | some i;  elem := value[i]} {
+} else := {elem | some i; elem := value[i]} if {
 	is_array(value)
 } else := {value}
 
-to_array(value) := value if is_array(value) else := [value]
+to_array(value) := value if is_array(value)
 
-get_element_name(value) := value if is_string(value) else := key { 
+else := [value]
+
+get_element_name(value) := value if is_string(value)
+
+else := key if {
 	is_object(value)
 	count(value) == 1
 	some key, _ in value
 }
 
-is_parameterized_expression(expression) := regex.match(`<<\s*(pipeline|parameters)(\.[\w-]+)+\s*>>`, expression)
\ No newline at end of file
+is_parameterized_expression(expression) := regex.match(`<<\s*(pipeline|parameters)(\.[\w-]+)+\s*>>`, expression)
@@ -0,0 +1,137 @@
+// Package sarif contains the subset of the SARIF 2.1.0 object model used to report lint findings,
+// policy violations and test results to code scanning tools.
+package sarif
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Level is the severity of a result.
+type Level string
+
+const (
+	LevelError   Level = "error"
+	LevelWarning Level = "warning"
+	LevelNote    Level = "note"
+	LevelNone    Level = "none"
+)
+
+// Log is the top level SARIF document.
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is a single invocation of a tool.
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+// Tool describes the tool that produced a run.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the component of the tool containing its rules.
+type Driver struct {
+	Name           string                `json:"name"`
+	InformationURI string                `json:"informationUri,omitempty"`
+	Rules          []ReportingDescriptor `json:"rules,omitempty"`
+}
+
+// ReportingDescriptor describes a rule results can refer to.
+type ReportingDescriptor struct {
+	ID                   string                  `json:"id"`
+	Name                 string                  `json:"name,omitempty"`
+	ShortDescription     *Message                `json:"shortDescription,omitempty"`
+	FullDescription      *Message                `json:"fullDescription,omitempty"`
+	HelpURI              string                  `json:"helpUri,omitempty"`
+	DefaultConfiguration *ReportingConfiguration `json:"defaultConfiguration,omitempty"`
+	Properties           map[string]any          `json:"properties,omitempty"`
+}
+
+// ReportingConfiguration is the default configuration of a rule.
+type ReportingConfiguration struct {
+	Level Level `json:"level,omitempty"`
+}
+
+// Message is a plain text message.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is a single finding.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	RuleIndex *int       `json:"ruleIndex,omitempty"`
+	Level     Level      `json:"level,omitempty"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+// Location is where a result was found.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a region within an artifact.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation identifies a file.
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a position within a file. Lines and columns start at 1.
+type Region struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// NewLocation returns a location for the given file, line and column. The region is omitted when line is not known.
+func NewLocation(file string, line, column int) Location {
+	loc := Location{PhysicalLocation: PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: file}}}
+	if line > 0 {
+		loc.PhysicalLocation.Region = &Region{StartLine: line, StartColumn: column}
+	}
+	return loc
+}
+
+// NewLog returns a log with a single run of the given driver.
+func NewLog(driver Driver) Log {
+	return Log{
+		Version: Version,
+		Schema:  Schema,
+		Runs:    []Run{{Tool: Tool{Driver: driver}, Results: []Result{}}},
+	}
+}
+
+// AddResult appends a result to the log's run, resolving the rule index from the driver's rules.
+func (log *Log) AddResult(result Result) {
+	run := &log.Runs[0]
+	for i, rule := range run.Tool.Driver.Rules {
+		if rule.ID == result.RuleID {
+			result.RuleIndex = &i
+			break
+		}
+	}
+	run.Results = append(run.Results, result)
+}
+
+// Encode writes the log as indented json.
+func (log Log) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -0,0 +1,103 @@
+// Package schemas embeds the JSON schemas describing the documents CircleCI passes to policies
+// during evaluation: the pipeline configuration as input, its compiled form under input._compiled_,
+// and the pipeline metadata under data.meta.
+package schemas
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+//go:embed *.json
+var schemaFS embed.FS
+
+var (
+	// InputRef is the schema reference used for the input document. It is the schema
+	// the opa compiler applies to input globally.
+	InputRef = ast.SchemaRootRef
+
+	// MetaRef is the schema reference used for data.meta.
+	MetaRef = ast.SchemaRootRef.Append(ast.StringTerm("meta"))
+)
+
+var (
+	input any
+	meta  any
+)
+
+func init() {
+	input = mustLoad("input.json")
+	meta = mustLoad("meta.json")
+
+	compiled := mustLoad("compiled.json").(map[string]any)
+	delete(compiled, "$schema")
+
+	properties := input.(map[string]any)["properties"].(map[string]any)
+	properties["_compiled_"] = compiled
+}
+
+// Input returns a copy of the schema of the pipeline configuration given as input, including input._compiled_.
+func Input() any {
+	return deepCopy(input)
+}
+
+// Meta returns a copy of the schema of the pipeline metadata given as data.meta.
+func Meta() any {
+	return deepCopy(meta)
+}
+
+// deepCopy copies a schema decoded from JSON, so that callers cannot modify the embedded schemas.
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for key, v := range value {
+			result[key] = deepCopy(v)
+		}
+		return result
+	case []any:
+		result := make([]any, len(value))
+		for i, v := range value {
+			result[i] = deepCopy(v)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// ModuleName returns the module map key used for the module built by Module.
+func ModuleName(pkg string) string {
+	return "circleci/schemas/" + pkg + ".rego"
+}
+
+// Module returns a rule-less rego module whose METADATA annotation binds data.meta to the meta schema
+// for the given package and all of its subpackages. The compiler only applies the input schema globally,
+// so any other document must be bound through annotations.
+func Module(pkg string) *ast.Module {
+	source := fmt.Sprintf(
+		"# METADATA\n# scope: subpackages\n# schemas:\n#   - data.meta: %s\npackage %s\n",
+		MetaRef,
+		pkg,
+	)
+	mod, err := ast.ParseModuleWithOpts(ModuleName(pkg), source, ast.ParserOptions{ProcessAnnotation: true})
+	if err != nil {
+		panic(err)
+	}
+	return mod
+}
+
+func mustLoad(name string) any {
+	data, err := schemaFS.ReadFile(name)
+	if err != nil {
+		panic(err)
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		panic(fmt.Errorf("invalid schema %s: %w", name, err))
+	}
+	return value
+}